@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"deploychain/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeploymentArtifacts handles the /api/deployments/:id/artifacts[/path]
+// endpoints. A file path downloads the artifact, a directory path or none
+// lists the artifacts below it, or downloads them as a zip with ?format=zip.
+func (h *Handler) GetDeploymentArtifacts(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+	if _, err := h.db.GetDeployment(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+	artifactPath := strings.Trim(c.Param("path"), "/")
+
+	if artifactPath != "" {
+		artifact, r, err := h.artifacts.Open(c.Request.Context(), id, artifactPath)
+		if err == nil {
+			defer r.Close()
+			contentType := mime.TypeByExtension(path.Ext(artifact.Path))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			c.DataFromReader(http.StatusOK, artifact.Size, contentType, r, map[string]string{
+				"Content-Disposition": fmt.Sprintf("attachment; filename=%q", path.Base(artifact.Path)),
+				"ETag":                `"` + artifact.Hash + `"`,
+			})
+			return
+		}
+		if !errors.Is(err, services.ErrArtifactNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read artifact"})
+			return
+		}
+	}
+
+	artifacts, err := h.artifacts.List(id, artifactPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch artifacts"})
+		return
+	}
+	if artifactPath != "" && len(artifacts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artifact not found"})
+		return
+	}
+
+	if c.Query("format") != "zip" {
+		c.JSON(http.StatusOK, artifacts)
+		return
+	}
+	name := fmt.Sprintf("deployment-%d-artifacts", id)
+	if artifactPath != "" {
+		name = fmt.Sprintf("deployment-%d-%s", id, strings.ReplaceAll(artifactPath, "/", "-"))
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	c.Status(http.StatusOK)
+	// The status is sent by now, a failure can only cut the archive short
+	if err := h.artifacts.WriteZip(c.Request.Context(), c.Writer, artifacts, artifactPath); err != nil {
+		c.Error(err)
+	}
+}
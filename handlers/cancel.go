@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deploychain/models"
+	"deploychain/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelDeployment handles the /api/deployments/:id/cancel endpoint
+func (h *Handler) CancelDeployment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	var request struct {
+		CancelledBy string `json:"cancelled_by"`
+		Reason      string `json:"reason"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if request.CancelledBy == "" {
+		request.CancelledBy = c.ClientIP()
+	}
+
+	err = h.db.CancelDeployment(id, request.CancelledBy, request.Reason)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	case errors.Is(err, services.ErrDeploymentFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Deployment already finished"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel deployment"})
+		return
+	}
+
+	// Stop the job right away if this replica runs it, others stop on their next heartbeat
+	h.workers.Cancel(id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deployment_id": id,
+		"status":        models.StatusCancelled,
+		"cancelled_by":  request.CancelledBy,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deploychain/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventKeepAlive is how often a comment is sent to keep idle streams open
+const eventKeepAlive = 15 * time.Second
+
+// StreamDeploymentEvents handles the /api/deployments/:id/events endpoint.
+// Events are sent as Server-Sent Events; reconnecting clients resume after
+// the Last-Event-ID header (or ?last_event_id=) they last received.
+func (h *Handler) StreamDeploymentEvents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.DefaultQuery("last_event_id", "0")
+	}
+	lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+		return
+	}
+
+	if _, err := h.db.GetDeployment(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	// Subscribe before replaying so no event falls between the two
+	events, unsubscribe := h.events.Subscribe(id)
+	defer unsubscribe()
+
+	missed, err := h.db.GetEventsAfter(id, lastID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deployment events"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Event IDs come from a sequence and concurrent writers can commit them
+	// out of order, so remember every event sent rather than the highest ID
+	delivered := make(map[int64]struct{}, len(missed))
+	for _, event := range missed {
+		writeEvent(c, event)
+		delivered[event.ID] = struct{}{}
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Fell behind or lost the listener, the client resumes with Last-Event-ID
+				return
+			}
+			if _, sent := delivered[event.ID]; sent {
+				continue
+			}
+			writeEvent(c, event)
+			delivered[event.ID] = struct{}{}
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeEvent writes a deployment event in SSE wire format
+func writeEvent(c *gin.Context, event models.DeploymentEvent) {
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
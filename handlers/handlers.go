@@ -2,7 +2,6 @@
 package handlers
 
 import (
-    "log"
     "net/http"
     "strconv"
     "strings"
@@ -16,16 +15,26 @@ import (
 // Handler holds service dependencies
 type Handler struct {
     db                *services.Database
-    daggerService     *services.DaggerService
-    blockchainService *services.BlockchainService
+    chains            *services.ChainBackends
+    networks          *services.NetworkRegistry
+    txs               *services.TxManager
+    sites             *services.SiteStore
+    artifacts         *services.ArtifactStore
+    events            *services.EventBroker
+    workers           *services.WorkerPool
 }
 
 // NewHandler creates a new handler with service dependencies
-func NewHandler(db *services.Database, dagger *services.DaggerService, blockchain *services.BlockchainService) *Handler {
+func NewHandler(db *services.Database, chains *services.ChainBackends, networks *services.NetworkRegistry, txs *services.TxManager, sites *services.SiteStore, artifacts *services.ArtifactStore, events *services.EventBroker, workers *services.WorkerPool) *Handler {
     return &Handler{
         db:                db,
-        daggerService:     dagger,
-        blockchainService: blockchain,
+        chains:            chains,
+        networks:          networks,
+        txs:               txs,
+        sites:             sites,
+        artifacts:         artifacts,
+        events:            events,
+        workers:           workers,
     }
 }
 
@@ -38,15 +47,29 @@ func (h *Handler) HealthCheck(c *gin.Context) {
         c.JSON(http.StatusServiceUnavailable, response)
         return
     }
-    if err := h.blockchainService.TestConnection(); err != nil {
+    if err := h.chains.TestConnection(c.Request.Context()); err != nil {
         response["status"] = "unhealthy"
-        response["error"] = "MultiBaas connection failed"
+        response["error"] = "Chain connection failed"
         c.JSON(http.StatusServiceUnavailable, response)
         return
     }
     c.JSON(http.StatusOK, response)
 }
 
+// deployKind reads the dry_run query parameter, a dry run only estimates the
+// deployment. It returns the deployment type and job kind to create.
+func deployKind(c *gin.Context) (string, string, bool) {
+    dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dry_run parameter"})
+        return "", "", false
+    }
+    if dryRun {
+        return models.TypeEstimate, models.JobKindEstimate, true
+    }
+    return models.TypeDApp, models.JobKindDeploy, true
+}
+
 // TriggerManualDeploy handles the /api/deploy endpoint
 func (h *Handler) TriggerManualDeploy(c *gin.Context) {
     var request struct {
@@ -59,56 +82,32 @@ func (h *Handler) TriggerManualDeploy(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
         return
     }
+    deploymentType, jobKind, ok := deployKind(c)
+    if !ok {
+        return
+    }
 
-    // Create deployment record
     deployment := models.Deployment{
         ProjectName:       request.ProjectName,
         Status:            models.StatusPending,
-        DeploymentType:    models.TypeDApp,
-        BlockchainNetwork: models.NetworkSepolia,
+        DeploymentType:    deploymentType,
+        BlockchainNetwork: h.networks.Default(),
         CreatedAt:         time.Now(),
         UpdatedAt:         time.Now(),
     }
 
-    id, err := h.db.CreateDeployment(deployment)
+    // Create deployment record and queue the pipeline for a worker
+    payload := models.DeployJobPayload{RepoURL: request.RepoURL, Branch: request.Branch}
+    id, err := h.db.CreateDeploymentWithJob(deployment, jobKind, payload)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deployment"})
         return
     }
 
-    // Start deployment pipeline asynchronously
-    go func() {
-        result, err := h.daggerService.RunPipeline(request.RepoURL, request.Branch, id)
-        if err != nil {
-            log.Printf("Pipeline failed: %v", err)
-            h.db.UpdateDeploymentStatus(id, models.StatusFailed, err.Error())
-            return
-        }
-
-        // Deploy contracts to blockchain
-        contractAddresses, txHashes, gasUsed, err := h.blockchainService.DeployContracts(result.CompiledContracts, models.NetworkSepolia)
-        if err != nil {
-            log.Printf("Contract deployment failed: %v", err)
-            h.db.UpdateDeploymentStatus(id, models.StatusFailed, err.Error())
-            return
-        }
-
-        // Update deployment with results
-        deployment.Status = models.StatusDeployed
-        deployment.URL = result.FrontendURL
-        deployment.ContractAddresses = contractAddresses
-        deployment.TransactionHashes = txHashes
-        deployment.GasUsed = gasUsed
-        deployment.UpdatedAt = time.Now()
-
-        if err := h.db.UpdateDeployment(deployment); err != nil {
-            log.Printf("Failed to update deployment: %v", err)
-        }
-    }()
-
     c.JSON(http.StatusCreated, gin.H{
-        "deployment_id": id,
-        "status":        "started",
+        "deployment_id":   id,
+        "deployment_type": deploymentType,
+        "status":          "queued",
     })
 }
 
@@ -138,6 +137,23 @@ func (h *Handler) GetDeployment(c *gin.Context) {
         return
     }
 
+    contracts, err := h.db.GetContractDeployments(id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contract deployments"})
+        return
+    }
+    deployment.Contracts = contracts
+
+    networks, err := h.db.GetDeploymentNetworks(id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deployment networks"})
+        return
+    }
+    if len(networks) > 0 {
+        deployment.Networks = networks
+        deployment.Matrix = models.NewContractMatrix(networks, contracts)
+    }
+
     c.JSON(http.StatusOK, deployment)
 }
 
@@ -154,28 +170,30 @@ func (h *Handler) HandleGitHubWebhook(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
         return
     }
+    deploymentType, jobKind, ok := deployKind(c)
+    if !ok {
+        return
+    }
 
     // Extract branch from ref (e.g., refs/heads/main -> main)
     branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
 
-    // Create deployment record
     deployment := models.Deployment{
         ProjectName:       payload.Repository.CloneURL,
         Status:            models.StatusPending,
-        DeploymentType:    models.TypeDApp,
-        BlockchainNetwork: models.NetworkSepolia,
+        DeploymentType:    deploymentType,
+        BlockchainNetwork: h.networks.Default(),
         CreatedAt:         time.Now(),
         UpdatedAt:         time.Now(),
     }
 
-    id, err := h.db.CreateDeployment(deployment)
+    // Create deployment record and queue the pipeline for a worker
+    job := models.DeployJobPayload{RepoURL: payload.Repository.CloneURL, Branch: branch}
+    id, err := h.db.CreateDeploymentWithJob(deployment, jobKind, job)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deployment"})
         return
     }
 
-    // Start deployment pipeline asynchronously
-    go h.daggerService.RunPipeline(payload.Repository.CloneURL, branch, id)
-
-    c.JSON(http.StatusOK, gin.H{"status": "received"})
+    c.JSON(http.StatusOK, gin.H{"status": "received", "deployment_id": id})
 }
\ No newline at end of file
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build log paging limits
+const (
+	defaultLogLimit = 500
+	maxLogLimit     = 5000
+)
+
+// GetDeploymentLogs handles the /api/deployments/:id/logs endpoint.
+// Pass the returned next_cursor as ?after= to fetch the following page.
+func (h *Handler) GetDeploymentLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	after, err := strconv.Atoi(c.DefaultQuery("after", "0"))
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+
+	if _, err := h.db.GetDeployment(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	logs, err := h.db.GetBuildLogs(id, after, limit, c.Query("stage"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch build logs"})
+		return
+	}
+
+	nextCursor := after
+	if len(logs) > 0 {
+		nextCursor = logs[len(logs)-1].ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":        logs,
+		"next_cursor": nextCursor,
+		"has_more":    len(logs) == limit,
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"deploychain/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListNetworks handles the /api/networks endpoint
+func (h *Handler) ListNetworks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"default":  h.networks.Default(),
+		"networks": h.networks.List(),
+	})
+}
+
+// GetDeploymentContracts handles the /api/deployments/:id/contracts endpoint,
+// listing the deployed contracts with links to the network's block explorer
+func (h *Handler) GetDeploymentContracts(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+	if _, err := h.db.GetDeployment(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	deployed, err := h.db.GetContractDeployments(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contract deployments"})
+		return
+	}
+
+	contracts := []models.ContractInfo{}
+	for _, contract := range deployed {
+		if contract.Status != models.ContractStatusDeployed {
+			continue
+		}
+		info := models.ContractInfo{
+			Name:    contract.Name,
+			Address: contract.Address,
+			Network: contract.Network,
+			ChainID: contract.ChainID,
+		}
+		if network, ok := h.networks.Get(contract.Network); ok {
+			info.EtherscanURL = network.AddressURL(contract.Address)
+			if info.ChainID == 0 {
+				info.ChainID = network.ChainID
+			}
+		}
+		contracts = append(contracts, info)
+	}
+	c.JSON(http.StatusOK, contracts)
+}
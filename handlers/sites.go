@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServeSite handles the /apps/:id/*filepath endpoint
+func (h *Handler) ServeSite(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	h.serveSiteFile(c, id, c.Param("filepath"))
+}
+
+// ServeSiteByHost serves deployed dApps requested on their own app-<id> host
+func (h *Handler) ServeSiteByHost(c *gin.Context) {
+	id, ok := h.sites.DeploymentFromHost(c.Request.Host)
+	if !ok {
+		c.Next()
+		return
+	}
+
+	h.serveSiteFile(c, id, c.Request.URL.Path)
+	c.Abort()
+}
+
+// serveSiteFile writes a file of a deployment's site, 404 if it does not exist
+func (h *Handler) serveSiteFile(c *gin.Context, id int, requestPath string) {
+	file, info, err := h.sites.Open(id, requestPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site not found"})
+		return
+	}
+	defer file.Close()
+
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
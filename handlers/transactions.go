@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deploychain/models"
+	"deploychain/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeploymentTransactions handles the /api/deployments/:id/transactions
+// endpoint, listing every transaction sent with the replacements of each
+func (h *Handler) ListDeploymentTransactions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+	if _, err := h.db.GetDeployment(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	txs, err := h.db.GetDeploymentTransactions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, txs)
+}
+
+// SpeedUpTransaction handles the /api/deployments/:id/transactions/:hash/speedup endpoint
+func (h *Handler) SpeedUpTransaction(c *gin.Context) {
+	h.replaceTransaction(c, models.TxKindSpeedUp)
+}
+
+// CancelTransaction handles the /api/deployments/:id/transactions/:hash/cancel endpoint
+func (h *Handler) CancelTransaction(c *gin.Context) {
+	h.replaceTransaction(c, models.TxKindCancel)
+}
+
+// replaceTransaction replaces the newest transaction sharing the nonce of the
+// given one. The deployment waiting for it picks the replacement up.
+func (h *Handler) replaceTransaction(c *gin.Context, kind string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	tx, err := h.db.GetDeploymentTransaction(id, c.Param("hash"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+		return
+	}
+	history, err := h.db.GetTransactionReplacements(tx.OriginalHash)
+	if err != nil || len(history) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+		return
+	}
+	network, ok := h.networks.Get(tx.Network)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Network " + tx.Network + " is no longer configured"})
+		return
+	}
+
+	latest := history[len(history)-1]
+	replacement, err := h.txs.Replace(c.Request.Context(), h.chains.Backend(network), latest, kind)
+	switch {
+	case errors.Is(err, services.ErrTxNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction already mined"})
+		return
+	case errors.Is(err, services.ErrNotReplaceable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, replacement)
+}
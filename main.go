@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -27,18 +28,47 @@ func main() {
 	}
 	defer db.Close()
 
-	daggerService := services.NewDaggerService()
-	blockchainService := services.NewBlockchainService()
+	networks, err := services.LoadNetworkRegistry()
+	if err != nil {
+		log.Fatalf("Failed to load networks: %v", err)
+	}
 
-	// Test MultiBaas connection
-	if err := blockchainService.TestConnection(); err != nil {
-		log.Printf("Warning: MultiBaas connection failed: %v", err)
+	sites := services.NewSiteStore()
+	artifacts := services.NewArtifactStore(db)
+	artifacts.Start(context.Background())
+	daggerService := services.NewDaggerService(sites, networks, artifacts)
+	signer, err := services.NewSignerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load transaction signer: %v", err)
+	}
+	if signer != nil {
+		log.Printf("Signing transactions locally as %s", signer.Address())
+	}
+	nonces := services.NewNonceManager(db)
+	blockchainService := services.NewBlockchainService(signer, nonces)
+	chains := services.NewChainBackends(blockchainService, signer, nonces, networks)
+	txs := services.NewTxManager(db)
+
+	// Test MultiBaas and JSON-RPC connections
+	if err := chains.TestConnection(context.Background()); err != nil {
+		log.Printf("Warning: chain connection failed: %v", err)
 	} else {
-		log.Println("✅ MultiBaas connected successfully")
+		log.Println("✅ Chain backends connected successfully")
+	}
+
+	// Run queued deployments in the background
+	deployer := services.NewDeployer(db, daggerService, chains, networks, txs, artifacts)
+	workers := services.NewWorkerPool(db, deployer.HandleJob)
+	workers.Start(context.Background())
+
+	// Stream deployment events to API subscribers
+	events := services.NewEventBroker(db)
+	if err := events.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start event broker: %v", err)
 	}
 
 	// Initialize handlers
-	handler := handlers.NewHandler(db, daggerService, blockchainService)
+	handler := handlers.NewHandler(db, chains, networks, txs, sites, artifacts, events, workers)
 
 	// Setup Gin router
 	r := setupRoutes(handler)
@@ -76,6 +106,9 @@ func setupRoutes(handler *handlers.Handler) *gin.Engine {
 	// Use CORS middleware
 	r.Use(cors.New(config))
 
+	// Serve deployed dApps on app-<id>.<domain> when host routing is enabled
+	r.Use(handler.ServeSiteByHost)
+
 	// Serve static files for dashboard
 	r.Static("/static", "./static")
 	r.GET("/", serveDashboard)
@@ -85,13 +118,26 @@ func setupRoutes(handler *handlers.Handler) *gin.Engine {
 	{
 		api.GET("/deployments", handler.ListDeployments)
 		api.GET("/deployments/:id", handler.GetDeployment)
+		api.GET("/deployments/:id/logs", handler.GetDeploymentLogs)
+		api.GET("/deployments/:id/events", handler.StreamDeploymentEvents)
+		api.POST("/deployments/:id/cancel", handler.CancelDeployment)
+		api.GET("/deployments/:id/contracts", handler.GetDeploymentContracts)
+		api.GET("/deployments/:id/transactions", handler.ListDeploymentTransactions)
+		api.GET("/deployments/:id/artifacts", handler.GetDeploymentArtifacts)
+		api.GET("/deployments/:id/artifacts/*path", handler.GetDeploymentArtifacts)
+		api.POST("/deployments/:id/transactions/:hash/speedup", handler.SpeedUpTransaction)
+		api.POST("/deployments/:id/transactions/:hash/cancel", handler.CancelTransaction)
 		api.POST("/deploy", handler.TriggerManualDeploy)
+		api.GET("/networks", handler.ListNetworks)
 		api.GET("/health", handler.HealthCheck)
 	}
 
 	// Webhook routes
 	r.POST("/webhook/github", handler.HandleGitHubWebhook)
 
+	// Deployed dApps
+	r.GET("/apps/:id/*filepath", handler.ServeSite)
+
 	return r
 }
 
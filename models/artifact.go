@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Artifact is a file kept for a deployment: compiled contracts, build-info,
+// the frontend bundle or build logs. Its content is stored once per SHA-256
+// hash, whichever deployments it belongs to.
+type Artifact struct {
+	DeploymentID int `json:"deployment_id" db:"deployment_id"`
+	// Path is relative to the artifacts of the deployment, e.g. contracts/build-info/<id>.json
+	Path      string    `json:"path" db:"path"`
+	Hash      string    `json:"sha256" db:"hash"`
+	Size      int64     `json:"size" db:"size"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Artifact path prefixes
+const (
+	ArtifactsContracts = "contracts"
+	ArtifactsFrontend  = "frontend"
+	ArtifactsLogs      = "logs"
+)
@@ -15,12 +15,24 @@ type Deployment struct {
     URL               string             `json:"url" db:"url"`
     DeploymentType    string             `json:"deployment_type" db:"deployment_type"`
     ContractAddresses ContractAddressMap `json:"contract_addresses" db:"contract_addresses"`
+    SkippedContracts  SkippedContractMap `json:"skipped_contracts,omitempty" db:"skipped_contracts"`
     TransactionHashes StringArray        `json:"transaction_hashes" db:"transaction_hashes"`
     BlockchainNetwork string             `json:"blockchain_network" db:"blockchain_network"`
+    DeployerAddress   string             `json:"deployer_address,omitempty" db:"deployer_address"`
+    ContractsPath     string             `json:"contracts_path,omitempty" db:"contracts_path"`
+    FrontendPath      string             `json:"frontend_path,omitempty" db:"frontend_path"`
     GasUsed           int64              `json:"gas_used" db:"gas_used"`
+    TotalCostWei      string             `json:"total_cost_wei" db:"total_cost_wei"`
+    TotalCost         string             `json:"total_cost" db:"-"`
     ErrorMessage      string             `json:"error_message" db:"error_message"`
+    CancelledBy       string             `json:"cancelled_by,omitempty" db:"cancelled_by"`
+    CancelledAt       *time.Time         `json:"cancelled_at,omitempty" db:"cancelled_at"`
     CreatedAt         time.Time          `json:"created_at" db:"created_at"`
     UpdatedAt         time.Time          `json:"updated_at" db:"updated_at"`
+    Compilers         CompilerSettingsMap  `json:"compilers,omitempty" db:"compilers"`
+    Contracts         []ContractDeployment `json:"contracts,omitempty" db:"-"`
+    Networks          []DeploymentNetwork  `json:"networks,omitempty" db:"-"`
+    Matrix            ContractMatrix       `json:"matrix,omitempty" db:"-"`
 }
 
 // ContractAddressMap represents a mapping of contract names to addresses
@@ -49,6 +61,32 @@ func (cam ContractAddressMap) Value() (driver.Value, error) {
     return json.Marshal(cam)
 }
 
+// SkippedContractMap maps compiled contracts that were not deployed to the reason why
+type SkippedContractMap map[string]string
+
+// Scan implements the sql.Scanner interface for reading from database
+func (scm *SkippedContractMap) Scan(value interface{}) error {
+    if value == nil {
+        *scm = make(SkippedContractMap)
+        return nil
+    }
+
+    bytes, ok := value.([]byte)
+    if !ok {
+        return errors.New("type assertion to []byte failed")
+    }
+
+    return json.Unmarshal(bytes, scm)
+}
+
+// Value implements the driver.Valuer interface for writing to database
+func (scm SkippedContractMap) Value() (driver.Value, error) {
+    if scm == nil {
+        return []byte("{}"), nil
+    }
+    return json.Marshal(scm)
+}
+
 // StringArray represents an array of strings for JSON storage
 type StringArray []string
 
@@ -77,32 +115,44 @@ func (sa StringArray) Value() (driver.Value, error) {
 
 // DeploymentStatus constants
 const (
-    StatusPending   = "pending"
-    StatusBuilding  = "building"
-    StatusDeployed  = "deployed"
-    StatusFailed    = "failed"
+    StatusPending    = "pending"
+    StatusBuilding   = "building"
+    StatusSubmitted  = "submitted"
+    StatusConfirming = "confirming"
+    StatusDeployed   = "deployed"
+    StatusFailed     = "failed"
+    StatusCancelled  = "cancelled"
+    // StatusPartiallyDeployed is a multi-network deployment that failed on some networks
+    StatusPartiallyDeployed = "partially_deployed"
+    // StatusEstimated is a dry run whose gas and cost were projected
+    StatusEstimated = "estimated"
 )
 
 // DeploymentType constants
 const (
     TypeStatic = "static"
     TypeDApp   = "dapp"
+    // TypeEstimate is a dry run that compiles and estimates without broadcasting
+    TypeEstimate = "estimate"
 )
 
-// NetworkName constants
+// Framework constants
 const (
-    NetworkEthereum = "ethereum"
-    NetworkSepolia  = "sepolia"
-    NetworkGoerli   = "goerli"
-    NetworkPolygon  = "polygon"
-    NetworkMumbai   = "mumbai"
+    FrameworkHardhat = "hardhat"
+    FrameworkFoundry = "foundry"
 )
 
 // BuildResult represents the result of a build operation
 type BuildResult struct {
     DeploymentType     string                       `json:"deployment_type"`
+    Framework          string                       `json:"framework,omitempty"`
+    PackageManager     string                       `json:"package_manager,omitempty"`
+    ContractsPath      string                       `json:"contracts_path,omitempty"`
+    FrontendPath       string                       `json:"frontend_path,omitempty"`
     FrontendURL        string                       `json:"frontend_url"`
+    Manifest           *Manifest                    `json:"manifest,omitempty"`
     CompiledContracts  map[string]*CompiledContract `json:"compiled_contracts,omitempty"`
+    SkippedContracts   SkippedContractMap           `json:"skipped_contracts,omitempty"`
     ContractAddresses  ContractAddressMap           `json:"contract_addresses,omitempty"`
     TransactionHashes  []string                     `json:"transaction_hashes,omitempty"`
     GasUsed           int64                        `json:"gas_used,omitempty"`
@@ -115,20 +165,206 @@ type CompiledContract struct {
     Name            string `json:"name"`
     Bytecode        string `json:"bytecode"`
     ABI             string `json:"abi"`
-    SourceCode      string `json:"source_code,omitempty"`
-    CompilerVersion string `json:"compiler_version,omitempty"`
+    // SourceCode is the solc standard-JSON input the contract was compiled from
+    SourceCode string `json:"source_code,omitempty"`
+    // CompilerVersion is the full solc version, e.g. 0.8.24+commit.e11b9ed9,
+    // empty when the artifacts do not record it
+    CompilerVersion  string `json:"compiler_version,omitempty"`
+    OptimizerEnabled bool   `json:"optimizer_enabled"`
+    OptimizerRuns    int    `json:"optimizer_runs,omitempty"`
+    EVMVersion       string `json:"evm_version,omitempty"`
+    ViaIR            bool   `json:"via_ir,omitempty"`
+    // License is the SPDX license identifier of the source file
+    License string `json:"license,omitempty"`
+    // Used to tell deployable contracts from libraries, tests and dependencies
+    SourcePath       string `json:"source_path,omitempty"`
+    DeployedBytecode string `json:"deployed_bytecode,omitempty"`
+    NeedsLinking     bool   `json:"needs_linking,omitempty"`
+}
+
+// Compiler returns the compiler settings the contract was built with
+func (c *CompiledContract) Compiler() CompilerSettings {
+    return CompilerSettings{
+        Version:          c.CompilerVersion,
+        OptimizerEnabled: c.OptimizerEnabled,
+        OptimizerRuns:    c.OptimizerRuns,
+        EVMVersion:       c.EVMVersion,
+        ViaIR:            c.ViaIR,
+        License:          c.License,
+    }
+}
+
+// CompilerSettings are the solc version and settings a contract was compiled
+// with, and the license of its source
+type CompilerSettings struct {
+    Version          string `json:"version"`
+    OptimizerEnabled bool   `json:"optimizer_enabled"`
+    OptimizerRuns    int    `json:"optimizer_runs,omitempty"`
+    EVMVersion       string `json:"evm_version,omitempty"`
+    ViaIR            bool   `json:"via_ir"`
+    License          string `json:"license,omitempty"`
+}
+
+// CompilerSettingsMap maps deployed contract names to their compiler settings
+type CompilerSettingsMap map[string]CompilerSettings
+
+// Scan implements the sql.Scanner interface for reading from database
+func (csm *CompilerSettingsMap) Scan(value interface{}) error {
+    if value == nil {
+        *csm = make(CompilerSettingsMap)
+        return nil
+    }
+
+    bytes, ok := value.([]byte)
+    if !ok {
+        return errors.New("type assertion to []byte failed")
+    }
+
+    return json.Unmarshal(bytes, csm)
+}
+
+// Value implements the driver.Valuer interface for writing to database
+func (csm CompilerSettingsMap) Value() (driver.Value, error) {
+    if csm == nil {
+        return []byte("{}"), nil
+    }
+    return json.Marshal(csm)
 }
 
 // ContractDeployment represents a blockchain contract deployment
 type ContractDeployment struct {
-    Name            string    `json:"name"`
-    Address         string    `json:"address"`
-    TransactionHash string    `json:"transaction_hash"`
-    GasUsed         int64     `json:"gas_used"`
-    Network         string    `json:"network"`
-    ChainID         int64     `json:"chain_id"`
-    Status          string    `json:"status"`
-    DeployedAt      time.Time `json:"deployed_at"`
+    ID                int       `json:"id" db:"id"`
+    DeploymentID      int       `json:"deployment_id" db:"deployment_id"`
+    Name              string    `json:"name" db:"name"`
+    Address           string    `json:"address" db:"address"`
+    TransactionHash   string    `json:"transaction_hash" db:"transaction_hash"`
+    BlockNumber       int64     `json:"block_number" db:"block_number"`
+    GasUsed           int64     `json:"gas_used" db:"gas_used"`
+    EffectiveGasPrice string    `json:"effective_gas_price" db:"effective_gas_price"`
+    CostWei           string    `json:"cost_wei" db:"cost_wei"`
+    Cost              string    `json:"cost" db:"-"`
+    Network           string    `json:"network" db:"network"`
+    ChainID           int64     `json:"chain_id" db:"chain_id"`
+    Status            string    `json:"status" db:"status"`
+    DeployedAt        time.Time `json:"deployed_at" db:"deployed_at"`
+    // ConstructorArgs is the hex ABI encoding of the constructor arguments, as
+    // submitted for source verification
+    ConstructorArgs     string `json:"constructor_args,omitempty" db:"constructor_args"`
+    VerificationStatus  string `json:"verification_status,omitempty" db:"verification_status"`
+    VerificationGUID    string `json:"verification_guid,omitempty" db:"verification_guid"`
+    VerificationMessage string `json:"verification_message,omitempty" db:"verification_message"`
+    // BytecodeMatch compares the code at Address with a local recompilation
+    BytecodeMatch        string `json:"bytecode_match,omitempty" db:"bytecode_match"`
+    BytecodeMatchMessage string `json:"bytecode_match_message,omitempty" db:"bytecode_match_message"`
+}
+
+// ContractDeployment status constants
+const (
+    ContractStatusDeployed = "deployed"
+    ContractStatusReverted = "reverted"
+    // ContractStatusNotDeployed marks a matrix cell of a contract never sent to a network
+    ContractStatusNotDeployed = "not_deployed"
+    // ContractStatusEstimated is a projected deployment of a dry run
+    ContractStatusEstimated = "estimated"
+    // ContractStatusSending marks a contract whose creation transaction is
+    // about to be sent, ContractStatusSubmitted one whose transaction awaits
+    // its receipt. A job resumed after its worker died sends neither again.
+    ContractStatusSending   = "sending"
+    ContractStatusSubmitted = "submitted"
+)
+
+// Contract source verification status constants
+const (
+    VerificationPending  = "pending"
+    VerificationVerified = "verified"
+    VerificationFailed   = "failed"
+    // VerificationSkipped marks contracts built without a standard-JSON input
+    VerificationSkipped = "skipped"
+)
+
+// Bytecode match constants, the outcome of comparing deployed code with a
+// recompilation of the contract's standard-JSON input
+const (
+    // BytecodeFullMatch is identical code, metadata hash included
+    BytecodeFullMatch = "full_match"
+    // BytecodePartialMatch is identical code with a different metadata hash,
+    // e.g. after a change of comments or source paths
+    BytecodePartialMatch = "partial_match"
+    BytecodeMismatch     = "mismatch"
+    // BytecodeUnchecked is reported when the contract could not be recompiled
+    BytecodeUnchecked = "unchecked"
+)
+
+// DeploymentNetwork is the outcome of a deployment on one of its networks.
+// Each network goes through the deployment statuses independently.
+type DeploymentNetwork struct {
+    ID                int                `json:"id" db:"id"`
+    DeploymentID      int                `json:"deployment_id" db:"deployment_id"`
+    Network           string             `json:"network" db:"network"`
+    ChainID           int64              `json:"chain_id" db:"chain_id"`
+    Status            string             `json:"status" db:"status"`
+    DeployerAddress   string             `json:"deployer_address,omitempty" db:"deployer_address"`
+    ContractAddresses ContractAddressMap `json:"contract_addresses" db:"contract_addresses"`
+    TransactionHashes StringArray        `json:"transaction_hashes" db:"transaction_hashes"`
+    GasUsed           int64              `json:"gas_used" db:"gas_used"`
+    TotalCostWei      string             `json:"total_cost_wei" db:"total_cost_wei"`
+    TotalCost         string             `json:"total_cost" db:"-"`
+    ErrorMessage      string             `json:"error_message,omitempty" db:"error_message"`
+    CreatedAt         time.Time          `json:"created_at" db:"created_at"`
+    UpdatedAt         time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// ContractMatrix maps network names to contract names to the deployment of
+// the contract on that network
+type ContractMatrix map[string]map[string]MatrixCell
+
+// MatrixCell is one contract on one network
+type MatrixCell struct {
+    Address         string `json:"address,omitempty"`
+    TransactionHash string `json:"transaction_hash,omitempty"`
+    GasUsed         int64  `json:"gas_used"`
+    Cost            string `json:"cost,omitempty"`
+    Status          string `json:"status"`
+    Verification    string `json:"verification,omitempty"`
+    BytecodeMatch   string `json:"bytecode_match,omitempty"`
+}
+
+// NewContractMatrix arranges the contract deployments of a deployment by
+// network. Contracts deployed on some networks but not others, e.g. after a
+// failure, are reported not_deployed on the others.
+func NewContractMatrix(networks []DeploymentNetwork, contracts []ContractDeployment) ContractMatrix {
+    matrix := make(ContractMatrix)
+    for _, network := range networks {
+        matrix[network.Network] = make(map[string]MatrixCell)
+    }
+
+    names := make(map[string]bool)
+    for _, contract := range contracts {
+        row, ok := matrix[contract.Network]
+        if !ok {
+            row = make(map[string]MatrixCell)
+            matrix[contract.Network] = row
+        }
+        row[contract.Name] = MatrixCell{
+            Address:         contract.Address,
+            TransactionHash: contract.TransactionHash,
+            GasUsed:         contract.GasUsed,
+            Cost:            contract.Cost,
+            Status:          contract.Status,
+            Verification:    contract.VerificationStatus,
+            BytecodeMatch:   contract.BytecodeMatch,
+        }
+        names[contract.Name] = true
+    }
+
+    for _, row := range matrix {
+        for name := range names {
+            if _, ok := row[name]; !ok {
+                row[name] = MatrixCell{Status: ContractStatusNotDeployed}
+            }
+        }
+    }
+    return matrix
 }
 
 // ContractInfo represents information about a deployed contract
@@ -142,6 +378,26 @@ type ContractInfo struct {
     Bytecode     string `json:"bytecode,omitempty"`
 }
 
+// BuildLog level constants
+const (
+    LogLevelInfo  = "info"
+    LogLevelWarn  = "warn"
+    LogLevelError = "error"
+)
+
+// BuildLog stage constants
+const (
+    StageClone    = "clone"
+    StageDetect   = "detect"
+    StageCompile  = "compile"
+    StageFrontend = "frontend"
+    StageDeploy   = "deploy"
+    StageConfirm  = "confirm"
+    StageEstimate = "estimate"
+    StageVerify   = "verify"
+    StagePipeline = "pipeline"
+)
+
 // BuildLog represents a build log entry
 type BuildLog struct {
     ID           int       `json:"id" db:"id"`
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeploymentEvent is a progress event pushed to deployment subscribers
+type DeploymentEvent struct {
+	ID           int64           `json:"id" db:"id"`
+	DeploymentID int             `json:"deployment_id" db:"deployment_id"`
+	Type         string          `json:"type" db:"type"`
+	Data         json.RawMessage `json:"data" db:"data"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+}
+
+// DeploymentEvent type constants
+const (
+	EventStatus     = "status"
+	EventStageStart = "stage_start"
+	EventStageEnd   = "stage_end"
+	EventLog        = "log"
+)
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job is a unit of background work leased by a worker from the jobs table
+type Job struct {
+	ID             int             `json:"id" db:"id"`
+	DeploymentID   int             `json:"deployment_id" db:"deployment_id"`
+	Kind           string          `json:"kind" db:"kind"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	MaxAttempts    int             `json:"max_attempts" db:"max_attempts"`
+	LeaseOwner     string          `json:"lease_owner,omitempty" db:"lease_owner"`
+	LeaseExpiresAt *time.Time      `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+	LastError      string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// DeployJobPayload is the payload of a JobKindDeploy job
+type DeployJobPayload struct {
+	RepoURL string `json:"repo_url"`
+	Branch  string `json:"branch"`
+}
+
+// JobStatus constants
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// JobKind constants
+const (
+	JobKindDeploy = "deploy"
+	// JobKindEstimate builds and estimates a deployment without broadcasting
+	JobKindEstimate = "estimate"
+)
@@ -0,0 +1,47 @@
+package models
+
+// ManifestVersion is the deploychain.yaml schema version understood by the server
+const ManifestVersion = 1
+
+// Manifest is the deploychain.yaml a repository uses to describe its deployment
+type Manifest struct {
+	Version   int               `yaml:"version" json:"version"`
+	Type      string            `yaml:"type" json:"type,omitempty"`
+	Networks  []string          `yaml:"networks" json:"networks,omitempty"`
+	Env       map[string]string `yaml:"env" json:"env,omitempty"`
+	Contracts ManifestContracts `yaml:"contracts" json:"contracts"`
+	Frontend  ManifestFrontend  `yaml:"frontend" json:"frontend"`
+}
+
+// BuildSettings overrides the container image, commands and environment of a build step
+type BuildSettings struct {
+	Image   string            `yaml:"image" json:"image,omitempty"`
+	Install string            `yaml:"install" json:"install,omitempty"`
+	Build   string            `yaml:"build" json:"build,omitempty"`
+	Env     map[string]string `yaml:"env" json:"env,omitempty"`
+}
+
+// ManifestContracts configures the contract build and which contracts are deployed
+type ManifestContracts struct {
+	BuildSettings `yaml:",inline"`
+	Path          string           `yaml:"path" json:"path,omitempty"`
+	Framework     string           `yaml:"framework" json:"framework,omitempty"`
+	Deploy        []ContractTarget `yaml:"deploy" json:"deploy,omitempty"`
+	// MaxFeeGwei caps the fee per gas stuck transactions are sped up to
+	MaxFeeGwei float64 `yaml:"max_fee_gwei" json:"max_fee_gwei,omitempty"`
+}
+
+// ContractTarget is a contract to deploy with its constructor arguments. Arguments
+// can reference other contracts of the deployment as ${Name.address}.
+type ContractTarget struct {
+	Name      string        `yaml:"name" json:"name"`
+	Args      []interface{} `yaml:"args" json:"args,omitempty"`
+	DependsOn []string      `yaml:"depends_on" json:"depends_on,omitempty"`
+}
+
+// ManifestFrontend configures the frontend build
+type ManifestFrontend struct {
+	BuildSettings `yaml:",inline"`
+	Path          string `yaml:"path" json:"path,omitempty"`
+	Output        string `yaml:"output" json:"output,omitempty"`
+}
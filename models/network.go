@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// Network is a blockchain network contracts can be deployed to
+type Network struct {
+	Name    string `json:"name" yaml:"-"`
+	ChainID int64  `json:"chain_id" yaml:"chain_id"`
+	// MultiBaasChain is the chain name used in MultiBaas API paths
+	MultiBaasChain string `json:"multibaas_chain,omitempty" yaml:"multibaas_chain"`
+	// RPCURL selects the JSON-RPC backend instead of MultiBaas. It often embeds
+	// a provider API key, so it is never serialized to API clients.
+	RPCURL string `json:"-" yaml:"rpc_url"`
+	// ExplorerURL is the block explorer base URL, links are <explorer_url>/address/<address>
+	// and <explorer_url>/tx/<hash>
+	ExplorerURL string `json:"explorer_url,omitempty" yaml:"explorer_url"`
+	// VerifyAPIURL is the Etherscan-compatible API contract sources are
+	// verified with, no verification without it
+	VerifyAPIURL string `json:"verify_api_url,omitempty" yaml:"verify_api_url"`
+	// VerifyAPIKey authenticates with the verification API
+	VerifyAPIKey   string         `json:"-" yaml:"verify_api_key"`
+	NativeCurrency NativeCurrency `json:"native_currency" yaml:"native_currency"`
+	// Confirmations is the number of blocks, counting the one a transaction is
+	// mined in, after which a deployment is reported deployed
+	Confirmations int  `json:"confirmations" yaml:"confirmations"`
+	Mainnet       bool `json:"mainnet" yaml:"mainnet"`
+}
+
+// NativeCurrency is the token gas is paid in
+type NativeCurrency struct {
+	Name     string `json:"name" yaml:"name"`
+	Symbol   string `json:"symbol" yaml:"symbol"`
+	Decimals int    `json:"decimals" yaml:"decimals"`
+}
+
+// AddressURL links to an address on the block explorer, "" without an explorer
+func (n *Network) AddressURL(address string) string {
+	if n.ExplorerURL == "" || address == "" {
+		return ""
+	}
+	return strings.TrimSuffix(n.ExplorerURL, "/") + "/address/" + address
+}
+
+// TransactionURL links to a transaction on the block explorer, "" without an explorer
+func (n *Network) TransactionURL(hash string) string {
+	if n.ExplorerURL == "" || hash == "" {
+		return ""
+	}
+	return strings.TrimSuffix(n.ExplorerURL, "/") + "/tx/" + hash
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeploymentTransaction is a transaction sent by a deployment. Replacements
+// of a stuck transaction share its nonce and link back to it.
+type DeploymentTransaction struct {
+	ID           int    `json:"id" db:"id"`
+	DeploymentID int    `json:"deployment_id" db:"deployment_id"`
+	Network      string `json:"network" db:"network"`
+	ContractName string `json:"contract_name" db:"contract_name"`
+	Hash         string `json:"hash" db:"hash"`
+	// OriginalHash is the hash of the first transaction with this nonce,
+	// Replaces the one this transaction replaced
+	OriginalHash string `json:"original_hash" db:"original_hash"`
+	Replaces     string `json:"replaces,omitempty" db:"replaces"`
+	Kind         string `json:"kind" db:"kind"`
+	Status       string `json:"status" db:"status"`
+	From         string `json:"from" db:"from_address"`
+	Nonce        int64  `json:"nonce" db:"nonce"`
+	GasPrice     string `json:"gas_price,omitempty" db:"gas_price"`
+	GasFeeCap    string `json:"gas_fee_cap,omitempty" db:"gas_fee_cap"`
+	GasTipCap    string `json:"gas_tip_cap,omitempty" db:"gas_tip_cap"`
+	// MaxFeePerGas caps the fees of replacements, in wei, "" for no cap
+	MaxFeePerGas string `json:"max_fee_per_gas,omitempty" db:"max_fee_per_gas"`
+	// Params holds the signed transaction fields needed to build a
+	// replacement, empty when the transaction was not signed locally
+	Params    json.RawMessage `json:"-" db:"params"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// DeploymentTransaction kind constants
+const (
+	TxKindDeploy  = "deploy"
+	TxKindSpeedUp = "speedup"
+	TxKindCancel  = "cancel"
+)
+
+// DeploymentTransaction status constants
+const (
+	TxStatusPending  = "pending"
+	TxStatusMined    = "mined"
+	TxStatusReplaced = "replaced"
+)
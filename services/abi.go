@@ -0,0 +1,305 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// abiArgument is a function or constructor parameter of a contract ABI
+type abiArgument struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Components []abiArgument `json:"components,omitempty"`
+}
+
+// abiEntry is a single item of a contract ABI
+type abiEntry struct {
+	Type    string        `json:"type"`
+	Name    string        `json:"name"`
+	Inputs  []abiArgument `json:"inputs"`
+	Outputs []abiArgument `json:"outputs"`
+}
+
+// parseABI decodes the entries of a JSON ABI
+func parseABI(abiJSON string) ([]abiEntry, error) {
+	if abiJSON == "" || abiJSON == "null" {
+		return nil, nil
+	}
+	var entries []abiEntry
+	if err := json.Unmarshal([]byte(abiJSON), &entries); err != nil {
+		return nil, fmt.Errorf("invalid ABI: %v", err)
+	}
+	return entries, nil
+}
+
+// constructorInputs returns the constructor parameters of an ABI, none if it has no constructor
+func constructorInputs(abiJSON string) ([]abiArgument, error) {
+	entries, err := parseABI(abiJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Type == "constructor" {
+			return entry.Inputs, nil
+		}
+	}
+	return nil, nil
+}
+
+// findFunction returns the function named method that takes argCount arguments
+func findFunction(abiJSON, method string, argCount int) (*abiEntry, error) {
+	entries, err := parseABI(abiJSON)
+	if err != nil {
+		return nil, err
+	}
+	var found []abiEntry
+	for _, entry := range entries {
+		if entry.Type == "function" && entry.Name == method {
+			if len(entry.Inputs) == argCount {
+				return &entry, nil
+			}
+			found = append(found, entry)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no function %s in ABI", method)
+	}
+	return nil, fmt.Errorf("function %s takes %d arguments (%s), got %d",
+		method, len(found[0].Inputs), describeArguments(found[0].Inputs), argCount)
+}
+
+// encodeConstructorArgs validates args against the constructor of abiJSON and converts
+// them to the JSON form MultiBaas expects: integers as decimal strings, bytes and
+// addresses as 0x-prefixed hex, tuples as positional lists.
+func encodeConstructorArgs(abiJSON string, args []interface{}) ([]interface{}, error) {
+	inputs, err := constructorInputs(abiJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(inputs) {
+		return nil, fmt.Errorf("constructor takes %d arguments (%s), got %d",
+			len(inputs), describeArguments(inputs), len(args))
+	}
+	return encodeArguments(inputs, args)
+}
+
+// encodeArguments converts args to the JSON form of inputs, see encodeConstructorArgs
+func encodeArguments(inputs []abiArgument, args []interface{}) ([]interface{}, error) {
+	encoded := make([]interface{}, len(args))
+	for i, input := range inputs {
+		value, err := encodeABIValue(input.Type, input.Components, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %v", i, argumentLabel(input), err)
+		}
+		encoded[i] = value
+	}
+	return encoded, nil
+}
+
+// encodeABIValue converts a single value to the JSON form of typ
+func encodeABIValue(typ string, components []abiArgument, value interface{}) (interface{}, error) {
+	// Arrays: T[] and T[k], the outermost dimension is the last one
+	if strings.HasSuffix(typ, "]") {
+		open := strings.LastIndex(typ, "[")
+		elemType := typ[:open]
+		size := typ[open+1 : len(typ)-1]
+
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list for %s, got %v", typ, value)
+		}
+		if size != "" {
+			n, err := strconv.Atoi(size)
+			if err != nil {
+				return nil, fmt.Errorf("unsupported type %s", typ)
+			}
+			if len(items) != n {
+				return nil, fmt.Errorf("expected %d items for %s, got %d", n, typ, len(items))
+			}
+		}
+		encoded := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := encodeABIValue(elemType, components, item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			encoded[i] = v
+		}
+		return encoded, nil
+	}
+
+	switch {
+	case typ == "tuple":
+		return encodeTuple(components, value)
+	case typ == "address":
+		s, ok := value.(string)
+		if !ok || !isHexAddress(s) {
+			return nil, fmt.Errorf("expected a 0x-prefixed 20 byte address, got %v", value)
+		}
+		return s, nil
+	case typ == "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("expected true or false, got %v", value)
+	case typ == "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int, int64, uint64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	case strings.HasPrefix(typ, "bytes"):
+		return encodeBytes(typ, value)
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		return encodeInteger(typ, value)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+}
+
+// encodeTuple accepts a struct as a positional list or a map keyed by component name
+func encodeTuple(components []abiArgument, value interface{}) (interface{}, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = make([]interface{}, len(components))
+		for i, component := range components {
+			item, ok := v[component.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing field %s", component.Name)
+			}
+			items[i] = item
+		}
+		if len(v) != len(components) {
+			return nil, fmt.Errorf("expected fields %s", describeArguments(components))
+		}
+	default:
+		return nil, fmt.Errorf("expected a list or map for tuple, got %v", value)
+	}
+	if len(items) != len(components) {
+		return nil, fmt.Errorf("expected %d tuple fields, got %d", len(components), len(items))
+	}
+
+	encoded := make([]interface{}, len(items))
+	for i, component := range components {
+		v, err := encodeABIValue(component.Type, component.Components, items[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", argumentLabel(component), err)
+		}
+		encoded[i] = v
+	}
+	return encoded, nil
+}
+
+// encodeInteger range checks an intN or uintN and returns it as a decimal string
+func encodeInteger(typ string, value interface{}) (interface{}, error) {
+	signed := strings.HasPrefix(typ, "int")
+	bits := 256
+	if size := strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n%8 != 0 || n < 8 || n > 256 {
+			return nil, fmt.Errorf("unsupported type %s", typ)
+		}
+		bits = n
+	}
+
+	n := new(big.Int)
+	switch v := value.(type) {
+	case int:
+		n.SetInt64(int64(v))
+	case int64:
+		n.SetInt64(v)
+	case uint64:
+		n.SetUint64(v)
+	case float64:
+		// JSON decodes every number as a float and YAML decodes exponents such
+		// as 1e18 as one, only integers below 2^53 are exact
+		if math.Abs(v) >= 1<<53 {
+			return nil, fmt.Errorf("%v may have lost precision, quote large integers as strings", v)
+		}
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("expected an integer, got %v", v)
+		}
+		n.SetInt64(int64(v))
+	case string:
+		s := strings.ReplaceAll(v, "_", "")
+		if _, ok := n.SetString(s, 0); !ok {
+			return nil, fmt.Errorf("expected an integer, got %q", v)
+		}
+	default:
+		return nil, fmt.Errorf("expected an integer, got %v", value)
+	}
+
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if signed {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	max.Sub(max, big.NewInt(1))
+	if n.Cmp(min) < 0 || n.Cmp(max) > 0 {
+		return nil, fmt.Errorf("%s out of range for %s", n, typ)
+	}
+	return n.String(), nil
+}
+
+// encodeBytes checks a bytes or bytesN value is hex of the right length
+func encodeBytes(typ string, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("expected 0x-prefixed hex, got %v", value)
+	}
+	data, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex %q", s)
+	}
+	if size := strings.TrimPrefix(typ, "bytes"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 || n > 32 {
+			return nil, fmt.Errorf("unsupported type %s", typ)
+		}
+		if len(data) != n {
+			return nil, fmt.Errorf("expected %d bytes for %s, got %d", n, typ, len(data))
+		}
+	}
+	return s, nil
+}
+
+// isHexAddress reports whether s is a 0x-prefixed 20 byte hex string
+func isHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// describeArguments formats parameters as a signature, e.g. "string name, uint256 supply"
+func describeArguments(args []abiArgument) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = strings.TrimSpace(arg.Type + " " + arg.Name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// argumentLabel names a parameter in error messages
+func argumentLabel(arg abiArgument) string {
+	if arg.Name != "" {
+		return arg.Name + " " + arg.Type
+	}
+	return arg.Type
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeConstructorArgs(t *testing.T) {
+	const tokenABI = `[{"type":"constructor","inputs":[{"name":"name","type":"string"},{"name":"supply","type":"uint256"}]}]`
+
+	tests := []struct {
+		name string
+		abi  string
+		args []interface{}
+		want []interface{}
+		// err is a substring of the expected error, empty for success
+		err string
+	}{
+		{
+			name: "no constructor",
+			abi:  `[{"type":"function","name":"transfer","inputs":[]}]`,
+			want: []interface{}{},
+		},
+		{
+			name: "integers as decimal strings",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", "1_000_000"},
+			want: []interface{}{"My Token", "1000000"},
+		},
+		{
+			name: "hex integer string",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", "0xff"},
+			want: []interface{}{"My Token", "255"},
+		},
+		{
+			name: "integer beyond float precision as a string",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", "1000000000000000000000000"},
+			want: []interface{}{"My Token", "1000000000000000000000000"},
+		},
+		{
+			name: "yaml int",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", 250},
+			want: []interface{}{"My Token", "250"},
+		},
+		{
+			name: "exact float",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", float64(1 << 52)},
+			want: []interface{}{"My Token", "4503599627370496"},
+		},
+		{
+			name: "float beyond 2^53",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", 1e18},
+			err:  "quote large integers as strings",
+		},
+		{
+			name: "float at 2^53",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", float64(1 << 53)},
+			err:  "quote large integers as strings",
+		},
+		{
+			name: "fractional float",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", 1.5},
+			err:  "expected an integer",
+		},
+		{
+			name: "NaN",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", math.NaN()},
+			err:  "expected an integer",
+		},
+		{
+			name: "negative unsigned",
+			abi:  tokenABI,
+			args: []interface{}{"My Token", -1},
+			err:  "out of range for uint256",
+		},
+		{
+			name: "wrong argument count",
+			abi:  tokenABI,
+			args: []interface{}{"My Token"},
+			err:  "constructor takes 2 arguments (string name, uint256 supply), got 1",
+		},
+		{
+			name: "int8 range",
+			abi:  `[{"type":"constructor","inputs":[{"name":"a","type":"int8"},{"name":"b","type":"int8"}]}]`,
+			args: []interface{}{-128, 128},
+			err:  "argument 1 (b int8): 128 out of range for int8",
+		},
+		{
+			name: "address, bytes and bool",
+			abi:  `[{"type":"constructor","inputs":[{"name":"owner","type":"address"},{"name":"salt","type":"bytes4"},{"name":"paused","type":"bool"}]}]`,
+			args: []interface{}{"0x5FbDB2315678afecb367f032d93F642f64180aa3", "0xdeadbeef", "true"},
+			want: []interface{}{"0x5FbDB2315678afecb367f032d93F642f64180aa3", "0xdeadbeef", true},
+		},
+		{
+			name: "short address",
+			abi:  `[{"type":"constructor","inputs":[{"name":"owner","type":"address"}]}]`,
+			args: []interface{}{"0x5FbDB2315678afecb367f032d93F642f64180a"},
+			err:  "expected a 0x-prefixed 20 byte address",
+		},
+		{
+			name: "wrong bytesN length",
+			abi:  `[{"type":"constructor","inputs":[{"name":"salt","type":"bytes4"}]}]`,
+			args: []interface{}{"0xdead"},
+			err:  "expected 4 bytes for bytes4, got 2",
+		},
+		{
+			name: "fixed size array",
+			abi:  `[{"type":"constructor","inputs":[{"name":"shares","type":"uint16[2]"}]}]`,
+			args: []interface{}{[]interface{}{1, "2"}},
+			want: []interface{}{[]interface{}{"1", "2"}},
+		},
+		{
+			name: "fixed size array length",
+			abi:  `[{"type":"constructor","inputs":[{"name":"shares","type":"uint16[2]"}]}]`,
+			args: []interface{}{[]interface{}{1}},
+			err:  "expected 2 items for uint16[2], got 1",
+		},
+		{
+			name: "tuple from a map",
+			abi:  `[{"type":"constructor","inputs":[{"name":"config","type":"tuple","components":[{"name":"fee","type":"uint24"},{"name":"recipient","type":"address"}]}]}]`,
+			args: []interface{}{map[string]interface{}{"recipient": "0x5FbDB2315678afecb367f032d93F642f64180aa3", "fee": 3000}},
+			want: []interface{}{[]interface{}{"3000", "0x5FbDB2315678afecb367f032d93F642f64180aa3"}},
+		},
+		{
+			name: "tuple missing a field",
+			abi:  `[{"type":"constructor","inputs":[{"name":"config","type":"tuple","components":[{"name":"fee","type":"uint24"},{"name":"recipient","type":"address"}]}]}]`,
+			args: []interface{}{map[string]interface{}{"fee": 3000}},
+			err:  "missing field recipient",
+		},
+		{
+			name: "invalid ABI",
+			abi:  `{`,
+			err:  "invalid ABI",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := encodeConstructorArgs(test.abi, test.args)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("encodeConstructorArgs() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encodeConstructorArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("encodeConstructorArgs() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
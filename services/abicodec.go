@@ -0,0 +1,376 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// abiType is a parsed ABI type used for the binary encoding of calls and constructors
+type abiType struct {
+	kind string // uint, int, address, bool, bytesN, bytes, string, tuple, array (T[k]) or slice (T[])
+	// size is the bit size of integers, the byte size of bytesN and the length of T[k]
+	size       int
+	elem       *abiType
+	components []abiType
+}
+
+// parseABIType parses a type such as "uint256", "bytes32[]" or "tuple[2]"
+func parseABIType(typ string, components []abiArgument) (abiType, error) {
+	if strings.HasSuffix(typ, "]") {
+		open := strings.LastIndex(typ, "[")
+		if open < 0 {
+			return abiType{}, fmt.Errorf("unsupported type %s", typ)
+		}
+		elem, err := parseABIType(typ[:open], components)
+		if err != nil {
+			return abiType{}, err
+		}
+		size := typ[open+1 : len(typ)-1]
+		if size == "" {
+			return abiType{kind: "slice", elem: &elem}, nil
+		}
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			return abiType{}, fmt.Errorf("unsupported type %s", typ)
+		}
+		return abiType{kind: "array", size: n, elem: &elem}, nil
+	}
+
+	switch {
+	case typ == "tuple":
+		t := abiType{kind: "tuple"}
+		for _, component := range components {
+			c, err := parseABIType(component.Type, component.Components)
+			if err != nil {
+				return abiType{}, err
+			}
+			t.components = append(t.components, c)
+		}
+		return t, nil
+	case typ == "address", typ == "bool", typ == "string", typ == "bytes":
+		return abiType{kind: typ}, nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || n < 1 || n > 32 {
+			return abiType{}, fmt.Errorf("unsupported type %s", typ)
+		}
+		return abiType{kind: "bytesN", size: n}, nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		kind := "int"
+		if strings.HasPrefix(typ, "uint") {
+			kind = "uint"
+		}
+		bits := 256
+		if size := strings.TrimPrefix(typ, kind); size != "" {
+			n, err := strconv.Atoi(size)
+			if err != nil || n%8 != 0 || n < 8 || n > 256 {
+				return abiType{}, fmt.Errorf("unsupported type %s", typ)
+			}
+			bits = n
+		}
+		return abiType{kind: kind, size: bits}, nil
+	default:
+		return abiType{}, fmt.Errorf("unsupported type %s", typ)
+	}
+}
+
+// parseABIArguments parses the types of a parameter list
+func parseABIArguments(args []abiArgument) ([]abiType, error) {
+	types := make([]abiType, len(args))
+	for i, arg := range args {
+		t, err := parseABIType(arg.Type, arg.Components)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = t
+	}
+	return types, nil
+}
+
+// dynamic reports whether values of the type are encoded in the tail of their enclosing sequence
+func (t abiType) dynamic() bool {
+	switch t.kind {
+	case "bytes", "string", "slice":
+		return true
+	case "array":
+		return t.elem.dynamic()
+	case "tuple":
+		for _, c := range t.components {
+			if c.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize is the number of bytes the type takes in the head of its enclosing sequence
+func (t abiType) headSize() int {
+	if t.dynamic() {
+		return 32
+	}
+	switch t.kind {
+	case "array":
+		return t.size * t.elem.headSize()
+	case "tuple":
+		size := 0
+		for _, c := range t.components {
+			size += c.headSize()
+		}
+		return size
+	}
+	return 32
+}
+
+// canonical returns the type as written in function signatures, tuples as (T1,T2)
+func (t abiType) canonical() string {
+	switch t.kind {
+	case "uint", "int":
+		return t.kind + strconv.Itoa(t.size)
+	case "bytesN":
+		return "bytes" + strconv.Itoa(t.size)
+	case "array":
+		return t.elem.canonical() + "[" + strconv.Itoa(t.size) + "]"
+	case "slice":
+		return t.elem.canonical() + "[]"
+	case "tuple":
+		parts := make([]string, len(t.components))
+		for i, c := range t.components {
+			parts[i] = c.canonical()
+		}
+		return "(" + strings.Join(parts, ",") + ")"
+	}
+	return t.kind
+}
+
+// functionSelector returns the first 4 bytes of the Keccak hash of a function signature
+func functionSelector(name string, types []abiType) []byte {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = t.canonical()
+	}
+	return keccak256([]byte(name + "(" + strings.Join(parts, ",") + ")"))[:4]
+}
+
+// abiEncode encodes values in the JSON form produced by encodeABIValue: integers
+// as decimal strings, addresses and bytes as 0x-prefixed hex, arrays and tuples as lists
+func abiEncode(types []abiType, values []interface{}) ([]byte, error) {
+	if len(types) != len(values) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(types), len(values))
+	}
+	headSize := 0
+	for _, t := range types {
+		headSize += t.headSize()
+	}
+
+	var head, tail []byte
+	for i, t := range types {
+		encoded, err := abiEncodeValue(t, values[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.dynamic() {
+			head = append(head, abiWord(big.NewInt(int64(headSize+len(tail))))...)
+			tail = append(tail, encoded...)
+		} else {
+			head = append(head, encoded...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+func abiEncodeValue(t abiType, value interface{}) ([]byte, error) {
+	switch t.kind {
+	case "uint", "int":
+		s, ok := value.(string)
+		n, valid := new(big.Int).SetString(s, 10)
+		if !ok || !valid {
+			return nil, fmt.Errorf("invalid integer %v", value)
+		}
+		if n.Sign() < 0 {
+			// Two's complement over 256 bits
+			n.Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return abiWord(n), nil
+	case "address":
+		s, _ := value.(string)
+		data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil || len(data) != 20 {
+			return nil, fmt.Errorf("invalid address %v", value)
+		}
+		return leftPad(data), nil
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid bool %v", value)
+		}
+		if b {
+			return abiWord(big.NewInt(1)), nil
+		}
+		return abiWord(big.NewInt(0)), nil
+	case "bytesN":
+		s, _ := value.(string)
+		data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil || len(data) != t.size {
+			return nil, fmt.Errorf("invalid bytes%d %v", t.size, value)
+		}
+		return rightPad(data), nil
+	case "bytes":
+		s, _ := value.(string)
+		data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes %v", value)
+		}
+		return append(abiWord(big.NewInt(int64(len(data)))), rightPad(data)...), nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid string %v", value)
+		}
+		return append(abiWord(big.NewInt(int64(len(s)))), rightPad([]byte(s))...), nil
+	case "tuple":
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid tuple %v", value)
+		}
+		return abiEncode(t.components, items)
+	case "array", "slice":
+		items, ok := value.([]interface{})
+		if !ok || (t.kind == "array" && len(items) != t.size) {
+			return nil, fmt.Errorf("invalid %s %v", t.canonical(), value)
+		}
+		types := make([]abiType, len(items))
+		for i := range types {
+			types[i] = *t.elem
+		}
+		encoded, err := abiEncode(types, items)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == "slice" {
+			return append(abiWord(big.NewInt(int64(len(items)))), encoded...), nil
+		}
+		return encoded, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t.kind)
+}
+
+// abiDecode decodes return data into the same JSON form abiEncode accepts, with
+// addresses checksummed
+func abiDecode(types []abiType, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(types))
+	offset := 0
+	for i, t := range types {
+		start := offset
+		if t.dynamic() {
+			word, err := abiReadWord(data, offset)
+			if err != nil {
+				return nil, err
+			}
+			if !word.IsInt64() || word.Int64() > int64(len(data)) {
+				return nil, fmt.Errorf("invalid offset %s", word)
+			}
+			start = int(word.Int64())
+		}
+		value, err := abiDecodeValue(t, data, start)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+		offset += t.headSize()
+	}
+	return values, nil
+}
+
+func abiDecodeValue(t abiType, data []byte, offset int) (interface{}, error) {
+	switch t.kind {
+	case "uint", "int", "bool", "address", "bytesN":
+		if offset+32 > len(data) {
+			return nil, fmt.Errorf("return data too short")
+		}
+		word := data[offset : offset+32]
+		switch t.kind {
+		case "bool":
+			return word[31] == 1, nil
+		case "address":
+			return checksumAddress(word[12:]), nil
+		case "bytesN":
+			return "0x" + hex.EncodeToString(word[:t.size]), nil
+		}
+		n := new(big.Int).SetBytes(word)
+		if t.kind == "int" && word[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return n.String(), nil
+	case "bytes", "string":
+		length, err := abiReadWord(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		if !length.IsInt64() || int64(offset+32)+length.Int64() > int64(len(data)) {
+			return nil, fmt.Errorf("return data too short")
+		}
+		content := data[offset+32 : offset+32+int(length.Int64())]
+		if t.kind == "string" {
+			return string(content), nil
+		}
+		return "0x" + hex.EncodeToString(content), nil
+	case "tuple":
+		if offset > len(data) {
+			return nil, fmt.Errorf("return data too short")
+		}
+		return abiDecode(t.components, data[offset:])
+	case "array", "slice":
+		size := t.size
+		if t.kind == "slice" {
+			length, err := abiReadWord(data, offset)
+			if err != nil {
+				return nil, err
+			}
+			if !length.IsInt64() || length.Int64() > int64(len(data)) {
+				return nil, fmt.Errorf("invalid length %s", length)
+			}
+			size = int(length.Int64())
+			offset += 32
+		}
+		if offset > len(data) {
+			return nil, fmt.Errorf("return data too short")
+		}
+		types := make([]abiType, size)
+		for i := range types {
+			types[i] = *t.elem
+		}
+		return abiDecode(types, data[offset:])
+	}
+	return nil, fmt.Errorf("unsupported type %s", t.kind)
+}
+
+// abiReadWord reads the 32 byte word at offset as an unsigned integer
+func abiReadWord(data []byte, offset int) (*big.Int, error) {
+	if offset < 0 || offset+32 > len(data) {
+		return nil, fmt.Errorf("return data too short")
+	}
+	return new(big.Int).SetBytes(data[offset : offset+32]), nil
+}
+
+// abiWord encodes a non-negative integer below 2^256 as a 32 byte word
+func abiWord(n *big.Int) []byte {
+	return leftPad(n.Bytes())
+}
+
+// leftPad pads data with zeros on the left to a 32 byte word
+func leftPad(data []byte) []byte {
+	word := make([]byte, 32)
+	copy(word[32-len(data):], data)
+	return word
+}
+
+// rightPad pads data with zeros on the right to a multiple of 32 bytes
+func rightPad(data []byte) []byte {
+	padded := make([]byte, (len(data)+31)/32*32)
+	copy(padded, data)
+	return padded
+}
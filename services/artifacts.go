@@ -0,0 +1,445 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deploychain/models"
+)
+
+// ErrArtifactNotFound is returned for a path a deployment has no artifact at
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// Garbage collection of expired artifacts. Blobs younger than blobGracePeriod
+// are kept even when unreferenced, their artifact may be about to be recorded.
+const (
+	artifactGCInterval = time.Hour
+	blobGracePeriod    = time.Hour
+)
+
+// ArtifactBlob is a blob held by an ArtifactBackend
+type ArtifactBlob struct {
+	Hash     string
+	StoredAt time.Time
+}
+
+// ArtifactBackend stores artifact contents by SHA-256 hash. The local
+// filesystem is the only backend, object storage can implement it later.
+type ArtifactBackend interface {
+	// Put stores the contents of r under hash. An existing blob is kept and its
+	// stored time reset, protecting it from garbage collection.
+	Put(ctx context.Context, hash string, r io.Reader) error
+	// Open reads a blob
+	Open(ctx context.Context, hash string) (io.ReadCloser, error)
+	// Delete removes a blob
+	Delete(ctx context.Context, hash string) error
+	// List returns every stored blob
+	List(ctx context.Context) ([]ArtifactBlob, error)
+}
+
+// localArtifactBackend keeps blobs on disk at <root>/<hash[:2]>/<hash>
+type localArtifactBackend struct {
+	root string
+}
+
+func (b *localArtifactBackend) path(hash string) string {
+	return filepath.Join(b.root, hash[:2], hash)
+}
+
+func (b *localArtifactBackend) Put(ctx context.Context, hash string, r io.Reader) error {
+	dest := b.path(hash)
+	if _, err := os.Stat(dest); err == nil {
+		// A blob shared with a new artifact is not garbage until the grace
+		// period passes again, its artifact being recorded after Put
+		now := time.Now()
+		return os.Chtimes(dest, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Written under a temporary name so a blob is never seen half written
+	tmp, err := os.CreateTemp(filepath.Dir(dest), hash+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != hash {
+		return fmt.Errorf("content hash %s does not match %s", got, hash)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (b *localArtifactBackend) Open(ctx context.Context, hash string) (io.ReadCloser, error) {
+	return os.Open(b.path(hash))
+}
+
+func (b *localArtifactBackend) Delete(ctx context.Context, hash string) error {
+	err := os.Remove(b.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *localArtifactBackend) List(ctx context.Context) ([]ArtifactBlob, error) {
+	var blobs []ArtifactBlob
+	err := filepath.WalkDir(b.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Only blobs are deleted, not temporary or foreign files
+		if entry.IsDir() || !isBlobHash(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, ArtifactBlob{Hash: entry.Name(), StoredAt: info.ModTime()})
+		return nil
+	})
+	return blobs, err
+}
+
+// isBlobHash reports whether name is a hex SHA-256 hash
+func isBlobHash(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// ArtifactStore keeps the build outputs of each deployment. Files are recorded
+// per deployment and path in the deployment_artifacts table, their contents
+// stored once by hash in the backend.
+type ArtifactStore struct {
+	db      *Database
+	backend ArtifactBackend
+	// retention is how long artifacts are kept, 0 to keep them forever
+	retention time.Duration
+}
+
+// NewArtifactStore creates an artifact store on the local filesystem
+// configured from the environment
+func NewArtifactStore(db *Database) *ArtifactStore {
+	root := os.Getenv("ARTIFACTS_DIR")
+	if root == "" {
+		root = "./build/artifact-store"
+	}
+	return &ArtifactStore{
+		db:        db,
+		backend:   &localArtifactBackend{root: root},
+		retention: time.Duration(envInt("ARTIFACT_RETENTION_DAYS", 30)) * 24 * time.Hour,
+	}
+}
+
+// AddFile stores a file as the artifact of a deployment at artifactPath,
+// replacing any artifact already there
+func (s *ArtifactStore) AddFile(ctx context.Context, deploymentID int, artifactPath string, data []byte) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if err := s.backend.Put(ctx, hash, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to store %s: %v", artifactPath, err)
+	}
+	return s.db.UpsertArtifact(models.Artifact{DeploymentID: deploymentID, Path: artifactPath, Hash: hash, Size: int64(len(data))})
+}
+
+// AddDirectory stores every file below a local directory as artifacts of a
+// deployment, under prefix
+func (s *ArtifactStore) AddDirectory(ctx context.Context, deploymentID int, prefix, dir string) error {
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		artifactPath := path.Join(prefix, filepath.ToSlash(rel))
+
+		hash, size, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		err = s.backend.Put(ctx, hash, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %v", artifactPath, err)
+		}
+		return s.db.UpsertArtifact(models.Artifact{DeploymentID: deploymentID, Path: artifactPath, Hash: hash, Size: size})
+	})
+}
+
+// hashFile returns the SHA-256 hash and size of a file
+func hashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// List returns the artifacts of a deployment below dir, all of them for "",
+// sorted by path
+func (s *ArtifactStore) List(deploymentID int, dir string) ([]models.Artifact, error) {
+	artifacts, err := s.db.GetArtifacts(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return artifacts, nil
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var below []models.Artifact
+	for _, artifact := range artifacts {
+		if strings.HasPrefix(artifact.Path, prefix) {
+			below = append(below, artifact)
+		}
+	}
+	return below, nil
+}
+
+// Open reads the artifact of a deployment at artifactPath
+func (s *ArtifactStore) Open(ctx context.Context, deploymentID int, artifactPath string) (*models.Artifact, io.ReadCloser, error) {
+	artifact, err := s.db.GetArtifact(deploymentID, artifactPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.backend.Open(ctx, artifact.Hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %v", artifactPath, err)
+	}
+	return artifact, r, nil
+}
+
+// WriteZip writes artifacts to w as a zip archive, with paths relative to dir
+func (s *ArtifactStore) WriteZip(ctx context.Context, w io.Writer, artifacts []models.Artifact, dir string) error {
+	archive := zip.NewWriter(w)
+	for _, artifact := range artifacts {
+		name := artifact.Path
+		if dir != "" {
+			name = strings.TrimPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: artifact.CreatedAt}
+		entry, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		r, err := s.backend.Open(ctx, artifact.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", artifact.Path, err)
+		}
+		_, err = io.Copy(entry, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// StoreLogs saves the build log of a deployment as logs/build.log
+func (s *ArtifactStore) StoreLogs(ctx context.Context, deploymentID int) error {
+	var b strings.Builder
+	after := 0
+	for {
+		logs, err := s.db.GetBuildLogs(deploymentID, after, maxLogPage, "")
+		if err != nil {
+			return err
+		}
+		for _, entry := range logs {
+			fmt.Fprintf(&b, "%s [%s] %s: %s\n", entry.Timestamp.UTC().Format(time.RFC3339), entry.Stage, entry.Level, entry.Message)
+			after = entry.ID
+		}
+		if len(logs) < maxLogPage {
+			break
+		}
+	}
+	return s.AddFile(ctx, deploymentID, path.Join(models.ArtifactsLogs, "build.log"), []byte(b.String()))
+}
+
+// maxLogPage is the number of build log entries read at once
+const maxLogPage = 5000
+
+// Start collects expired artifacts periodically until ctx is cancelled
+func (s *ArtifactStore) Start(ctx context.Context) {
+	if s.retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(artifactGCInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.CollectGarbage(ctx); err != nil {
+				log.Printf("Artifact garbage collection failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CollectGarbage forgets the artifacts older than the retention period, then
+// deletes the blobs no artifact refers to anymore
+func (s *ArtifactStore) CollectGarbage(ctx context.Context) error {
+	expired, err := s.db.DeleteArtifactsBefore(time.Now().Add(-s.retention))
+	if err != nil {
+		return err
+	}
+
+	referenced, err := s.db.GetArtifactHashes()
+	if err != nil {
+		return err
+	}
+	blobs, err := s.backend.List(ctx)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, blob := range blobs {
+		if referenced[blob.Hash] || time.Since(blob.StoredAt) < blobGracePeriod {
+			continue
+		}
+		if err := s.backend.Delete(ctx, blob.Hash); err != nil {
+			return err
+		}
+		deleted++
+	}
+	if expired > 0 || deleted > 0 {
+		log.Printf("Removed %d expired artifacts and %d unreferenced blobs", expired, deleted)
+	}
+	return nil
+}
+
+// UpsertArtifact records an artifact of a deployment, replacing the one at its path
+func (d *Database) UpsertArtifact(artifact models.Artifact) error {
+	_, err := d.db.Exec(`
+		INSERT INTO deployment_artifacts (deployment_id, path, hash, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (deployment_id, path) DO UPDATE SET
+			hash = EXCLUDED.hash,
+			size = EXCLUDED.size,
+			created_at = CURRENT_TIMESTAMP`,
+		artifact.DeploymentID, artifact.Path, artifact.Hash, artifact.Size,
+	)
+	return err
+}
+
+// GetArtifacts returns the artifacts of a deployment sorted by path
+func (d *Database) GetArtifacts(deploymentID int) ([]models.Artifact, error) {
+	rows, err := d.db.Query(`
+		SELECT deployment_id, path, hash, size, created_at
+		FROM deployment_artifacts
+		WHERE deployment_id = $1
+		ORDER BY path`,
+		deploymentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artifacts := []models.Artifact{}
+	for rows.Next() {
+		var artifact models.Artifact
+		if err := rows.Scan(&artifact.DeploymentID, &artifact.Path, &artifact.Hash, &artifact.Size, &artifact.CreatedAt); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, rows.Err()
+}
+
+// GetArtifact returns the artifact of a deployment at a path, ErrArtifactNotFound if there is none
+func (d *Database) GetArtifact(deploymentID int, artifactPath string) (*models.Artifact, error) {
+	var artifact models.Artifact
+	err := d.db.QueryRow(`
+		SELECT deployment_id, path, hash, size, created_at
+		FROM deployment_artifacts
+		WHERE deployment_id = $1 AND path = $2`,
+		deploymentID, artifactPath,
+	).Scan(&artifact.DeploymentID, &artifact.Path, &artifact.Hash, &artifact.Size, &artifact.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// DeleteArtifactsBefore forgets the artifacts stored before a time and
+// returns how many were removed
+func (d *Database) DeleteArtifactsBefore(before time.Time) (int64, error) {
+	res, err := d.db.Exec(`DELETE FROM deployment_artifacts WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetArtifactHashes returns the set of blob hashes referenced by artifacts
+func (d *Database) GetArtifactHashes() (map[string]bool, error) {
+	rows, err := d.db.Query(`SELECT DISTINCT hash FROM deployment_artifacts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes[hash] = true
+	}
+	return hashes, rows.Err()
+}
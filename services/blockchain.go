@@ -3,9 +3,14 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/big"
+	"net/http"
 	"os"
-	"strconv"
+	"strings"
+	"sync"
 
 	"deploychain/models"
 
@@ -14,136 +19,288 @@ import (
 
 // BlockchainService handles MultiBaas interactions
 type BlockchainService struct {
-	client *multibaas.APIClient
-	ctx    context.Context
+	client          *multibaas.APIClient
+	baseURL         string
+	apiKey          string
+	deployerAddress string
+	signer          Signer
+	nonces          *NonceManager
+
+	chainIDsMu sync.Mutex
+	chainIDs   map[multibaas.ChainName]*big.Int
 }
 
-// NewBlockchainService initializes a new MultiBaas client
-func NewBlockchainService() *BlockchainService {
+// NewBlockchainService initializes a new MultiBaas client. Transactions are signed
+// locally with signer, or by MultiBaas for MB_DEPLOYER_ADDRESS when signer is nil.
+// Either way their nonces are allocated by nonces.
+func NewBlockchainService(signer Signer, nonces *NonceManager) *BlockchainService {
 	conf := multibaas.NewConfiguration()
 	client := multibaas.NewAPIClient(conf)
 
 	// Configure the SDK using environment variables
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, multibaas.ContextServerVariables, map[string]string{
-		"base_url": os.Getenv("MB_BASE_URL"),
-	})
-	ctx = context.WithValue(ctx, multibaas.ContextAccessToken, os.Getenv("MB_API_KEY"))
-
 	return &BlockchainService{
-		client: client,
-		ctx:    ctx,
+		client:          client,
+		baseURL:         os.Getenv("MB_BASE_URL"),
+		apiKey:          os.Getenv("MB_API_KEY"),
+		deployerAddress: os.Getenv("MB_DEPLOYER_ADDRESS"),
+		signer:          signer,
+		nonces:          nonces,
+		chainIDs:        make(map[multibaas.ChainName]*big.Int),
 	}
 }
 
-// TestConnection checks the MultiBaas API connection
-func (bs *BlockchainService) TestConnection() error {
-	// Using a common chain name like "ethereum" to test connection
-	// You might want to make this configurable
-	_, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, "ethereum").Execute()
-	return err
+// authContext derives a request context carrying the MultiBaas server and
+// credentials, so callers can cancel in-flight MultiBaas calls through ctx
+func (bs *BlockchainService) authContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, multibaas.ContextServerVariables, map[string]string{
+		"base_url": bs.baseURL,
+	})
+	return context.WithValue(ctx, multibaas.ContextAccessToken, bs.apiKey)
 }
 
 // GetChainStatus gets the status of a specific blockchain
-func (bs *BlockchainService) GetChainStatus(chain multibaas.ChainName) (*multibaas.GetChainStatus200Response, error) {
-	resp, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, chain).Execute()
+func (bs *BlockchainService) GetChainStatus(ctx context.Context, chain multibaas.ChainName) (*multibaas.GetChainStatus200Response, error) {
+	resp, _, err := bs.client.ChainsAPI.GetChainStatus(bs.authContext(ctx), chain).Execute()
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
-// DeployContract deploys a single contract to the specified network
-func (bs *BlockchainService) DeployContract(chain multibaas.ChainName, contractAddr string, contractLabel string, request multibaas.PostMethodArgs) (*multibaas.CallContractFunction200Response, error) {
-	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, "deploy").PostMethodArgs(request).Execute()
+// UploadContract adds a compiled contract to the MultiBaas library and returns
+// its label and version. The version is derived from the bytecode and ABI, so
+// redeploying an unchanged contract reuses the uploaded one.
+func (bs *BlockchainService) UploadContract(ctx context.Context, contract *models.CompiledContract) (string, string, error) {
+	label := contractLabel(contract.Name)
+	version := contractVersion(contract)
+
+	bin := contract.Bytecode
+	request := multibaas.BaseContract{
+		Label:        label,
+		ContractName: contract.Name,
+		Version:      version,
+		Bin:          &bin,
+		RawAbi:       contract.ABI,
+		UserDoc:      "{}",
+		DeveloperDoc: "{}",
+	}
+	_, _, err := bs.client.ContractsAPI.CreateContract(bs.authContext(ctx), label).BaseContract(request).Execute()
 	if err != nil {
-		return nil, err
+		// The same label and version is already in the library
+		if mbErr, ok := multibaas.IsMultiBaasErr(err); ok && mbErr.Status == http.StatusConflict {
+			return label, version, nil
+		}
+		return "", "", bs.HandleMultiBaasError(err)
 	}
-	return resp, nil
+	return label, version, nil
 }
 
-// CallContractFunction calls a function on a deployed contract
-func (bs *BlockchainService) CallContractFunction(chain multibaas.ChainName, contractAddr string, contractLabel string, method string, args []interface{}) (*multibaas.CallContractFunction200Response, error) {
-	contractOverride := true
-	payload := multibaas.PostMethodArgs{
-		Args:             args,
-		ContractOverride: &contractOverride,
+// DeployerAddress returns the address deployment transactions are sent from
+func (bs *BlockchainService) DeployerAddress() string {
+	if bs.signer != nil {
+		return bs.signer.Address()
+	}
+	return bs.deployerAddress
+}
+
+// DeployContract creates the deployment transaction of an uploaded contract version
+// and submits it. With a local signer the unsigned transaction returned by MultiBaas
+// is signed here, otherwise MultiBaas signs it for the deployer address.
+// The transaction is built unsigned first, its nonce being the account's pending
+// transaction count, then sent with a nonce from the nonce manager. The locally
+// signed transaction is returned too, nil when MultiBaas signed it.
+func (bs *BlockchainService) DeployContract(ctx context.Context, chain multibaas.ChainName, label, version string, args []interface{}) (*multibaas.TransactionToSignResponse, *UnsignedTx, error) {
+	from := bs.DeployerAddress()
+	if from == "" {
+		return nil, nil, fmt.Errorf("no deployer configured, set SIGNER_KEYSTORE or MB_DEPLOYER_ADDRESS")
 	}
 
-	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, method).PostMethodArgs(payload).Execute()
+	signAndSubmit := false
+	request := multibaas.PostMethodArgs{
+		Args:          args,
+		From:          &from,
+		SignAndSubmit: &signAndSubmit,
+	}
+	resp, _, err := bs.client.ContractsAPI.DeployContractByVersion(bs.authContext(ctx), label, version).PostMethodArgs(request).Execute()
 	if err != nil {
-		return nil, err
+		return nil, nil, bs.HandleMultiBaasError(err)
 	}
-	return resp, nil
-}
 
-// DeployContracts deploys compiled contracts to the specified network
-// This uses the available CallContractFunction API since direct deployment methods aren't available
-func (bs *BlockchainService) DeployContracts(contracts map[string]*models.CompiledContract, chain multibaas.ChainName) (models.ContractAddressMap, []string, int64, error) {
-	addresses := make(models.ContractAddressMap)
-	var txHashes []string
-	var totalGasUsed int64
+	chainID, err := bs.chainID(ctx, chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	lease, err := bs.nonces.Acquire(chainID.Int64(), from, uint64(resp.Result.Tx.Nonce))
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for contractLabel, contract := range contracts {
-		// Prepare constructor arguments for deployment
-		contractOverride := true
-		deployArgs := multibaas.PostMethodArgs{
-			Args:             []interface{}{}, // Constructor arguments - empty for now, can be customized
-			ContractOverride: &contractOverride,
+	if bs.signer == nil {
+		nonce := int64(lease.Nonce)
+		signAndSubmit = true
+		request.Nonce = &nonce
+		resp, _, err = bs.client.ContractsAPI.DeployContractByVersion(bs.authContext(ctx), label, version).PostMethodArgs(request).Execute()
+		if err != nil {
+			lease.Release()
+			return nil, nil, bs.HandleMultiBaasError(err)
 		}
+		lease.Commit()
+		return &resp.Result, nil, nil
+	}
 
-		// Since direct deployment API isn't available, we'll need to use CallContractFunction
-		// with a deployment-specific approach. This might require the contract to be pre-uploaded
-		// to MultiBaas via the web interface or another method.
-		resp, _, err := bs.client.ContractsAPI.CallContractFunction(
-			bs.ctx,
-			chain,
-			contract.Name, // Empty contract address for deployment
-			contractLabel, // Contract label that should exist in MultiBaas library
-			"constructor", // Constructor method
-		).PostMethodArgs(deployArgs).Execute()
+	resp.Result.Tx.Nonce = int64(lease.Nonce)
+	unsigned, err := unsignedTxFromMultiBaas(&resp.Result.Tx)
+	if err != nil {
+		lease.Release()
+		return nil, nil, err
+	}
+	hash, err := bs.SubmitTransaction(ctx, chain, unsigned)
+	if err != nil {
+		lease.Release()
+		return nil, nil, err
+	}
+	lease.Commit()
+	resp.Result.Tx.Hash = &hash
+	resp.Result.Submitted = true
+	return &resp.Result, unsigned, nil
+}
 
-		if err != nil {
-			// If deployment fails, it might be because the contract needs to be uploaded first
-			return nil, nil, 0, fmt.Errorf("deployment failed for contract %s: %w. Contract may need to be uploaded to MultiBaas library first", contractLabel, err)
-		}
+// SubmitTransaction signs a transaction with the local signer, submits it
+// through MultiBaas and returns its hash
+func (bs *BlockchainService) SubmitTransaction(ctx context.Context, chain multibaas.ChainName, unsigned *UnsignedTx) (string, error) {
+	if bs.signer == nil {
+		return "", fmt.Errorf("no local signer configured, set SIGNER_KEYSTORE")
+	}
+	chainID, err := bs.chainID(ctx, chain)
+	if err != nil {
+		return "", err
+	}
+	// Never sign for a chain other than the one we are deploying to
+	if unsigned.ChainID != nil && unsigned.ChainID.Cmp(chainID) != 0 {
+		return "", fmt.Errorf("transaction is for chain ID %s, %s has chain ID %s", unsigned.ChainID, chain, chainID)
+	}
+	unsigned.ChainID = chainID
 
-		// Extract deployment results from response
-		if result := resp.Result; result != (multibaas.CallContractFunction200ResponseAllOfResult{}) {
-			// Try to extract transaction information
-			if result.TransactionToSignResponse != nil {
-				tx := resp.Result.TransactionToSignResponse.Tx
+	raw, hash, err := bs.signer.SignTransaction(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	}
 
-				// Get contract address (might be in ContractAddress field)
-				if tx.From != "" {
-					addresses[contractLabel] = tx.From
-				}
+	submission := multibaas.SignedTransactionSubmission{SignedTx: "0x" + hex.EncodeToString(raw)}
+	_, _, err = bs.client.ChainsAPI.SubmitSignedTransaction(bs.authContext(ctx), chain).SignedTransactionSubmission(submission).Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to submit signed transaction: %w", bs.HandleMultiBaasError(err))
+	}
+	return hash, nil
+}
+
+// chainID returns the chain ID MultiBaas reports for chain, cached after the first lookup
+func (bs *BlockchainService) chainID(ctx context.Context, chain multibaas.ChainName) (*big.Int, error) {
+	bs.chainIDsMu.Lock()
+	defer bs.chainIDsMu.Unlock()
+
+	if id, ok := bs.chainIDs[chain]; ok {
+		return id, nil
+	}
+	status, err := bs.GetChainStatus(ctx, chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID of %s: %w", chain, bs.HandleMultiBaasError(err))
+	}
+	id := big.NewInt(status.Result.ChainID)
+	bs.chainIDs[chain] = id
+	return id, nil
+}
 
-				// Get transaction hash
-				if tx.Hash != nil && *tx.Hash != "" {
-					txHashes = append(txHashes, *tx.Hash)
-				}
+// unsignedTxFromMultiBaas converts a MultiBaas transaction to sign, whose
+// amounts are decimal strings and data is hex
+func unsignedTxFromMultiBaas(tx *multibaas.TransactionToSign) (*UnsignedTx, error) {
+	unsigned := &UnsignedTx{
+		Type:  int(tx.Type),
+		Nonce: uint64(tx.Nonce),
+		Gas:   uint64(tx.Gas),
+	}
 
-				// Get gas used
-				if tx.GasPrice != nil {
-					gasPrice, err := strconv.Atoi(*tx.GasPrice)
-					if err != nil {
-						fmt.Println(err)
-					} else {
-						totalGasUsed += int64(gasPrice)
-					}
-				}
-			}
+	var err error
+	amounts := []struct {
+		name  string
+		value *string
+		dest  **big.Int
+	}{
+		{"chainID", tx.ChainID, &unsigned.ChainID},
+		{"gasPrice", tx.GasPrice, &unsigned.GasPrice},
+		{"gasFeeCap", tx.GasFeeCap, &unsigned.GasFeeCap},
+		{"gasTipCap", tx.GasTipCap, &unsigned.GasTipCap},
+		{"value", tx.Value, &unsigned.Value},
+	}
+	for _, amount := range amounts {
+		if amount.value == nil || *amount.value == "" {
+			continue
+		}
+		n, ok := new(big.Int).SetString(*amount.value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q", amount.name, *amount.value)
 		}
+		*amount.dest = n
+	}
 
-		// If we couldn't extract the contract address from transaction,
-		// we might need to query it separately or handle it differently
-		if _, exists := addresses[contractLabel]; !exists {
-			fmt.Printf("Warning: Could not extract contract address for %s\n", contractLabel)
+	if to := tx.To.Get(); to != nil && *to != "" {
+		if unsigned.To, err = hex.DecodeString(strings.TrimPrefix(*to, "0x")); err != nil || len(unsigned.To) != 20 {
+			return nil, fmt.Errorf("invalid to address %q", *to)
 		}
 	}
+	if unsigned.Data, err = hex.DecodeString(strings.TrimPrefix(tx.Data, "0x")); err != nil {
+		return nil, fmt.Errorf("invalid transaction data: %v", err)
+	}
+	return unsigned, nil
+}
 
-	return addresses, txHashes, totalGasUsed, nil
+// GetTransactionReceipt returns the receipt of a transaction, or nil if it is not mined
+func (bs *BlockchainService) GetTransactionReceipt(ctx context.Context, chain multibaas.ChainName, txHash string) (*multibaas.TransactionReceipt, error) {
+	resp, _, err := bs.client.ChainsAPI.GetTransactionReceipt(bs.authContext(ctx), chain, txHash).Execute()
+	if err != nil {
+		// Not found until the transaction is mined
+		if mbErr, ok := multibaas.IsMultiBaasErr(err); ok && mbErr.Status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, bs.HandleMultiBaasError(err)
+	}
+	return &resp.Result, nil
+}
+
+// CallContractFunction calls a function on a deployed contract
+func (bs *BlockchainService) CallContractFunction(ctx context.Context, chain multibaas.ChainName, contractAddr string, contractLabel string, method string, args []interface{}) (*multibaas.CallContractFunction200Response, error) {
+	contractOverride := true
+	payload := multibaas.PostMethodArgs{
+		Args:             args,
+		ContractOverride: &contractOverride,
+	}
+
+	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.authContext(ctx), chain, contractAddr, contractLabel, method).PostMethodArgs(payload).Execute()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// contractLabel converts a contract name to a MultiBaas library label,
+// which only allows lowercase letters, digits, dashes and underscores
+func contractLabel(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, name)
+}
+
+// contractVersion derives a library version from the contract's bytecode and ABI
+func contractVersion(contract *models.CompiledContract) string {
+	sum := sha256.Sum256([]byte(contract.Bytecode + contract.ABI))
+	return "sha-" + hex.EncodeToString(sum[:6])
 }
 
 // HandleMultiBaasError provides better error handling for MultiBaas errors
@@ -153,348 +310,3 @@ func (bs *BlockchainService) HandleMultiBaasError(err error) error {
 	}
 	return err
 }
-
-// // services/blockchain.go
-// package services
-
-// import (
-// 	"context"
-// 	"fmt"
-// 	"os"
-
-// 	"deploychain/models"
-
-// 	multibaas "github.com/curvegrid/multibaas-sdk-go"
-// )
-
-// // BlockchainService handles MultiBaas interactions
-// type BlockchainService struct {
-// 	client *multibaas.APIClient
-// 	ctx    context.Context
-// }
-
-// // NewBlockchainService initializes a new MultiBaas client
-// func NewBlockchainService() *BlockchainService {
-// 	conf := multibaas.NewConfiguration()
-// 	client := multibaas.NewAPIClient(conf)
-
-// 	// Configure the SDK using environment variables
-// 	ctx := context.Background()
-// 	ctx = context.WithValue(ctx, multibaas.ContextServerVariables, map[string]string{
-// 		"base_url": os.Getenv("MB_BASE_URL"),
-// 	})
-// 	ctx = context.WithValue(ctx, multibaas.ContextAccessToken, os.Getenv("MB_API_KEY"))
-
-// 	return &BlockchainService{
-// 		client: client,
-// 		ctx:    ctx,
-// 	}
-// }
-
-// // TestConnection checks the MultiBaas API connection
-// func (bs *BlockchainService) TestConnection() error {
-// 	// Using a common chain name like "ethereum" to test connection
-// 	// You might want to make this configurable
-// 	_, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, "ethereum").Execute()
-// 	return err
-// }
-
-// // GetChainStatus gets the status of a specific blockchain
-// func (bs *BlockchainService) GetChainStatus(chain multibaas.ChainName) (*multibaas.GetChainStatus200Response, error) {
-// 	resp, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, chain).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // DeployContract deploys a single contract to the specified network
-// func (bs *BlockchainService) DeployContract(chain multibaas.ChainName, contractAddr string, contractLabel string, request multibaas.PostMethodArgs) (*multibaas.CallContractFunction200Response, error) {
-// 	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, "deploy").PostMethodArgs(request).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // CallContractFunction calls a function on a deployed contract
-// func (bs *BlockchainService) CallContractFunction(chain multibaas.ChainName, contractAddr string, contractLabel string, method string, args []interface{}) (*multibaas.CallContractFunction200Response, error) {
-// 	contractOverride := true
-// 	payload := multibaas.PostMethodArgs{
-// 		Args:             args,
-// 		ContractOverride: &contractOverride,
-// 	}
-
-// 	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, method).PostMethodArgs(payload).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // UploadContract uploads a contract to MultiBaas library
-// func (bs *BlockchainService) UploadContract(contractLabel string, contract *models.CompiledContract) error {
-// 	uploadRequest := multibaas.ContractUploadRequest{
-// 		Label:       contractLabel,
-// 		Abi:         contract.ABI,
-// 		Bytecode:    contract.Bytecode,
-// 		Source:      &contract.Source,
-// 		CompilerVersion: &contract.CompilerVersion,
-// 	}
-
-// 	_, _, err := bs.client.ContractsAPI.UploadContract(bs.ctx).ContractUploadRequest(uploadRequest).Execute()
-// 	return err
-// }
-
-// // DeployContracts deploys compiled contracts to the specified network
-// func (bs *BlockchainService) DeployContracts(contracts map[string]*models.CompiledContract, chain multibaas.ChainName) (models.ContractAddressMap, []string, int64, error) {
-// 	addresses := make(models.ContractAddressMap)
-// 	var txHashes []string
-// 	var totalGasUsed int64
-
-// 	for contractLabel, contract := range contracts {
-// 		// First, upload the contract to MultiBaas library if needed
-// 		err := bs.UploadContract(contractLabel, contract)
-// 		if err != nil {
-// 			// Contract might already exist, continue with deployment
-// 			fmt.Printf("Warning: Contract upload failed for %s: %v\n", contractLabel, err)
-// 		}
-
-// 		// Prepare deployment arguments (constructor arguments)
-// 		deployRequest := multibaas.ApiCreateContractRequest{}
-// 		// deployRequest := multibaas.DeployContractRequest{
-// 		// 	Label: contractLabel,
-// 		// 	Args:  []interface{}{}, // Empty constructor args, adjust as needed
-// 		// }
-
-// 		// Deploy the contract
-// 		deployResp, _, err := bs.client.ContractsAPI.DeployContract(bs.ctx, contract.Name).DeployContractRequest(deployRequest).Execute()
-// 		if err != nil {
-// 			return nil, nil, 0, err
-// 		}
-
-// 		// Extract deployment results from response
-// 		if deployResp.Result != nil {
-// 			result := deployResp.Result
-
-// 			// Get contract address
-// 			if result.ContractAddress != nil {
-// 				addresses[contractLabel] = *result.ContractAddress
-// 			}
-
-// 			// Get transaction hash
-// 			if result.TxHash != nil {
-// 				txHashes = append(txHashes, *result.TxHash)
-// 			}
-
-// 			// Get gas used
-// 			if result.GasUsed != nil {
-// 				totalGasUsed += int64(*result.GasUsed)
-// 			}
-// 		}
-// 	}
-
-// 	return addresses, txHashes, totalGasUsed, nil
-// }
-
-// // HandleMultiBaasError provides better error handling for MultiBaas errors
-// func (bs *BlockchainService) HandleMultiBaasError(err error) error {
-// 	if mbErr, ok := multibaas.IsMultiBaasErr(err); ok {
-// 		return fmt.Errorf("MultiBaas error (status %d): %s", mbErr.Status, mbErr.Message)
-// 	}
-// 	return err
-// }
-
-// // services/blockchain.go
-// package services
-
-// import (
-// 	"context"
-// 	"fmt"
-// 	"os"
-
-// 	"deploychain/models"
-
-// 	multibaas "github.com/curvegrid/multibaas-sdk-go"
-// )
-
-// // BlockchainService handles MultiBaas interactions
-// type BlockchainService struct {
-// 	client *multibaas.APIClient
-// 	ctx    context.Context
-// }
-
-// // NewBlockchainService initializes a new MultiBaas client
-// func NewBlockchainService() *BlockchainService {
-// 	conf := multibaas.NewConfiguration()
-// 	client := multibaas.NewAPIClient(conf)
-
-// 	// Configure the SDK using environment variables
-// 	ctx := context.Background()
-// 	ctx = context.WithValue(ctx, multibaas.ContextServerVariables, map[string]string{
-// 		"base_url": os.Getenv("MB_BASE_URL"),
-// 	})
-// 	ctx = context.WithValue(ctx, multibaas.ContextAccessToken, os.Getenv("MB_API_KEY"))
-
-// 	return &BlockchainService{
-// 		client: client,
-// 		ctx:    ctx,
-// 	}
-// }
-
-// // TestConnection checks the MultiBaas API connection
-// func (bs *BlockchainService) TestConnection() error {
-// 	// Using a common chain name like "ethereum" to test connection
-// 	// You might want to make this configurable
-// 	_, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, "ethereum").Execute()
-// 	return err
-// }
-
-// // GetChainStatus gets the status of a specific blockchain
-// func (bs *BlockchainService) GetChainStatus(chain multibaas.ChainName) (*multibaas.GetChainStatus200Response, error) {
-// 	resp, _, err := bs.client.ChainsAPI.GetChainStatus(bs.ctx, chain).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // DeployContract deploys a single contract to the specified network
-// func (bs *BlockchainService) DeployContract(chain multibaas.ChainName, contractAddr string, contractLabel string, request multibaas.PostMethodArgs) (*multibaas.CallContractFunction200Response, error) {
-// 	// Note: The actual contract deployment might require different API calls
-// 	// This is using the contract function call as shown in the example
-// 	// You may need to use a different API endpoint for actual deployment
-// 	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, "deploy").PostMethodArgs(request).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // CallContractFunction calls a function on a deployed contract
-// func (bs *BlockchainService) CallContractFunction(chain multibaas.ChainName, contractAddr string, contractLabel string, method string, args []interface{}) (*multibaas.CallContractFunction200Response, error) {
-// 	contractOverride := true
-// 	payload := multibaas.PostMethodArgs{
-// 		Args:             args,
-// 		ContractOverride: &contractOverride,
-// 	}
-
-// 	resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, chain, contractAddr, contractLabel, method).PostMethodArgs(payload).Execute()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return resp, nil
-// }
-
-// // DeployContracts deploys compiled contracts to the specified network
-// // Note: This method may need to be adapted based on the actual MultiBaas deployment API
-// func (bs *BlockchainService) DeployContracts(contracts map[string]*models.CompiledContract, network multibaas.ChainName) (models.ContractAddressMap, []string, int64, error) {
-// 	addresses := make(models.ContractAddressMap)
-// 	var txHashes []string
-// 	var totalGasUsed int64
-
-// 	// Note: The actual deployment process might be different
-// 	// This is a placeholder implementation that needs to be adapted
-// 	// based on the actual MultiBaas contract deployment API
-
-// 	for name, contract := range contracts {
-// 		// You'll need to check the MultiBaas documentation for the correct
-// 		// contract deployment API endpoint and payload structure
-
-// 		// This is a placeholder - the actual deployment might involve:
-// 		// 1. Uploading the contract bytecode and ABI
-// 		// 2. Calling a deployment endpoint
-// 		// 3. Getting the transaction hash and contract address from the response
-
-// 		contractOverride := true
-// 		payload := multibaas.PostMethodArgs{
-// 			Args: []interface{}{
-// 				contract.Bytecode,
-// 				contract.ABI,
-// 			},
-// 			ContractOverride: &contractOverride,
-// 		}
-
-// 		// This is a placeholder call - you'll need to replace with actual deployment API
-// 		resp, _, err := bs.client.ContractsAPI.CallContractFunction(bs.ctx, network, "deployment", name, "deploy").PostMethodArgs(payload).Execute()
-// 		if err != nil {
-// 			return nil, nil, 0, err
-// 		}
-
-// 		// Extract deployment results from response
-// 		// These fields might be different based on actual API response
-// 		if resp.Result != nil && resp.Result.MethodCallResponse != nil {
-// 			// You'll need to adapt this based on the actual response structure
-// 			addresses[name] = "placeholder_address"            // Extract from resp
-// 			txHashes = append(txHashes, "placeholder_tx_hash") // Extract from resp
-// 			totalGasUsed += 21000                              // Extract from resp
-// 		}
-// 	}
-
-// 	return addresses, txHashes, totalGasUsed, nil
-// }
-
-// // HandleMultiBaasError provides better error handling for MultiBaas errors
-// func (bs *BlockchainService) HandleMultiBaasError(err error) error {
-// 	if mbErr, ok := multibaas.IsMultiBaasErr(err); ok {
-// 		// You can add custom error handling logic here
-// 		return fmt.Errorf("MultiBaas error (status %d): %s", mbErr.Status, mbErr.Message)
-// 	}
-// 	return err
-// }
-
-// // services/blockchain.go
-// package services
-
-// import (
-//     "os"
-
-//     "deploychain/models"
-
-//     multibaas "github.com/curvegrid/multibaas-sdk-go"
-// )
-
-// // BlockchainService handles MultiBaas interactions
-// type BlockchainService struct {
-//     client *multibaas.APIClient
-// }
-
-// // NewBlockchainService initializes a new MultiBaas client
-// func NewBlockchainService() *BlockchainService {
-//     client := multibaas.NewAPIClient(&multibaas.Config{
-//         BaseURL: os.Getenv("MB_BASE_URL"),
-//         APIKey:  os.Getenv("MB_API_KEY"),
-//     })
-//     return &BlockchainService{client: client}
-// }
-
-// // TestConnection checks the MultiBaas API connection
-// func (bs *BlockchainService) TestConnection() error {
-//     _, err := bs.client.GetChains()
-//     return err
-// }
-
-// // DeployContracts deploys compiled contracts to the specified network
-// func (bs *BlockchainService) DeployContracts(contracts map[string]*models.CompiledContract, network string) (models.ContractAddressMap, []string, int64, error) {
-//     addresses := make(models.ContractAddressMap)
-//     var txHashes []string
-//     var totalGasUsed int64
-
-//     for name, contract := range contracts {
-//         deployment, err := bs.client.DeployContract(network, multibaas.DeployContractRequest{
-//             ContractName:    name,
-//             Bytecode:        contract.Bytecode,
-//             ABI:             contract.ABI,
-//             ConstructorArgs: []interface{}{},
-//         })
-//         if err != nil {
-//             return nil, nil, 0, err
-//         }
-
-//         addresses[name] = deployment.Address
-//         txHashes = append(txHashes, deployment.TransactionHash)
-//         totalGasUsed += deployment.GasUsed
-//     }
-
-//     return addresses, txHashes, totalGasUsed, nil
-// }
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	multibaas "github.com/curvegrid/multibaas-sdk-go"
+)
+
+// fakeNonceStore hands out consecutive nonces from next
+type fakeNonceStore struct {
+	next     uint64
+	released []uint64
+}
+
+func (s *fakeNonceStore) AllocateNonce(chainID int64, address string, pending uint64, resync bool) (uint64, error) {
+	if s.next < pending {
+		s.next = pending
+	}
+	s.next++
+	return s.next - 1, nil
+}
+
+func (s *fakeNonceStore) ReleaseNonce(chainID int64, address string, nonce uint64) error {
+	s.released = append(s.released, nonce)
+	return nil
+}
+
+// fakeMultiBaas serves the MultiBaas endpoints used to deploy a contract with a
+// local signer, recording the deployment request and the submitted transactions
+type fakeMultiBaas struct {
+	t         *testing.T
+	chainID   int64
+	tx        map[string]interface{}
+	deploy    map[string]interface{}
+	submitted []string
+}
+
+func (f *fakeMultiBaas) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+		f.t.Errorf("%s %s: Authorization = %q", r.Method, r.URL.Path, got)
+	}
+
+	var result interface{}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v0/chains/ethereum/status":
+		result = map[string]interface{}{"chainID": f.chainID, "blockNumber": 100}
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v0/contracts/token/sha-1/deploy":
+		if err := json.NewDecoder(r.Body).Decode(&f.deploy); err != nil {
+			f.t.Errorf("invalid deploy request: %v", err)
+		}
+		result = map[string]interface{}{"kind": "TransactionToSignResponse", "submitted": false, "tx": f.tx}
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v0/chains/ethereum/transactions/submit":
+		var body struct {
+			SignedTx string `json:"signedTx"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("invalid submit request: %v", err)
+		}
+		f.submitted = append(f.submitted, body.SignedTx)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 404, "message": "not found"})
+		return
+	}
+
+	response := map[string]interface{}{"status": 200, "message": "success"}
+	if result != nil {
+		response["result"] = result
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestDeployContractSignsLocally(t *testing.T) {
+	signer, err := NewKeySigner(mustHex(t, eip155Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MultiBaas builds the transaction with the pending nonce 5, the nonce
+	// manager has already handed out 5 and 6
+	fake := &fakeMultiBaas{t: t, chainID: 1, tx: map[string]interface{}{
+		"type":      TxTypeDynamicFee,
+		"from":      signer.Address(),
+		"nonce":     5,
+		"gasTipCap": "2000000000",
+		"gasFeeCap": "20000000000",
+		"gas":       300000,
+		"to":        nil,
+		"value":     "0",
+		"data":      "0x6080604052",
+		"chainID":   "0x1",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := &fakeNonceStore{next: 7}
+	bs := &BlockchainService{
+		client:   multibaas.NewAPIClient(multibaas.NewConfiguration()),
+		baseURL:  server.URL,
+		apiKey:   "test-key",
+		signer:   signer,
+		nonces:   &NonceManager{store: store, accounts: make(map[string]*nonceAccount)},
+		chainIDs: make(map[multibaas.ChainName]*big.Int),
+	}
+
+	result, unsigned, err := bs.DeployContract(context.Background(), "ethereum", "token", "sha-1", []interface{}{"Token", "TKN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.deploy["from"] != signer.Address() || fake.deploy["signAndSubmit"] == true {
+		t.Errorf("deploy request = %v, want an unsigned transaction from %s", fake.deploy, signer.Address())
+	}
+	if len(fake.submitted) != 1 {
+		t.Fatalf("submitted %d transactions, want 1", len(fake.submitted))
+	}
+
+	want, wantHash, err := signer.SignTransaction(&UnsignedTx{
+		Type:      TxTypeDynamicFee,
+		ChainID:   big.NewInt(1),
+		Nonce:     7,
+		GasTipCap: gwei(2),
+		GasFeeCap: gwei(20),
+		Gas:       300000,
+		Value:     big.NewInt(0),
+		Data:      mustHex(t, "6080604052"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustHex(t, fake.submitted[0]); !bytes.Equal(got, want) {
+		t.Errorf("broadcast %x, want %x", got, want)
+	}
+	if !result.Submitted || result.Tx.Hash == nil || *result.Tx.Hash != wantHash {
+		t.Errorf("result = %+v, want submitted with hash %s", result, wantHash)
+	}
+	if unsigned == nil || unsigned.Nonce != 7 || unsigned.To != nil {
+		t.Errorf("unsigned = %+v, want a contract creation with nonce 7", unsigned)
+	}
+	if len(store.released) != 0 {
+		t.Errorf("released nonces %v", store.released)
+	}
+}
+
+func TestDeployContractRefusesOtherChain(t *testing.T) {
+	signer, err := NewKeySigner(mustHex(t, eip155Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MultiBaas reports chain 1 but builds a transaction for chain 5
+	fake := &fakeMultiBaas{t: t, chainID: 1, tx: map[string]interface{}{
+		"type":     TxTypeLegacy,
+		"from":     signer.Address(),
+		"nonce":    0,
+		"gasPrice": "1000000000",
+		"gas":      300000,
+		"to":       nil,
+		"value":    "0",
+		"data":     "0x6080604052",
+		"chainID":  "5",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := &fakeNonceStore{}
+	bs := &BlockchainService{
+		client:   multibaas.NewAPIClient(multibaas.NewConfiguration()),
+		baseURL:  server.URL,
+		apiKey:   "test-key",
+		signer:   signer,
+		nonces:   &NonceManager{store: store, accounts: make(map[string]*nonceAccount)},
+		chainIDs: make(map[multibaas.ChainName]*big.Int),
+	}
+
+	if _, _, err := bs.DeployContract(context.Background(), "ethereum", "token", "sha-1", nil); err == nil {
+		t.Fatal("deployed a transaction for another chain")
+	}
+	if len(fake.submitted) != 0 {
+		t.Errorf("broadcast %v", fake.submitted)
+	}
+	if len(store.released) != 1 || store.released[0] != 0 {
+		t.Errorf("released nonces %v, want [0]", store.released)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"deploychain/models"
+
+	"dagger.io/dagger"
+)
+
+// BuildLogger records pipeline output for one deployment in the build_logs table
+type BuildLogger struct {
+	db           *Database
+	deploymentID int
+}
+
+// NewBuildLogger creates a build logger for a deployment
+func NewBuildLogger(db *Database, deploymentID int) *BuildLogger {
+	return &BuildLogger{db: db, deploymentID: deploymentID}
+}
+
+// Info records an informational message for a stage
+func (l *BuildLogger) Info(stage, format string, args ...interface{}) {
+	l.write(stage, models.LogLevelInfo, []string{fmt.Sprintf(format, args...)})
+}
+
+// Warn records a warning for a stage
+func (l *BuildLogger) Warn(stage, format string, args ...interface{}) {
+	l.write(stage, models.LogLevelWarn, []string{fmt.Sprintf(format, args...)})
+}
+
+// Error records an error for a stage
+func (l *BuildLogger) Error(stage, format string, args ...interface{}) {
+	l.write(stage, models.LogLevelError, []string{fmt.Sprintf(format, args...)})
+}
+
+// StartStage records the start of a pipeline stage
+func (l *BuildLogger) StartStage(stage string) {
+	l.publish(models.EventStageStart, map[string]string{"stage": stage})
+}
+
+// EndStage records the end of a pipeline stage, failed if err is not nil
+func (l *BuildLogger) EndStage(stage string, err error) {
+	data := map[string]string{"stage": stage, "result": "success"}
+	if err != nil {
+		data["result"] = "failed"
+		data["error"] = err.Error()
+	}
+	l.publish(models.EventStageEnd, data)
+}
+
+// Output records command output line by line
+func (l *BuildLogger) Output(stage, level, output string) {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return
+	}
+	l.write(stage, level, strings.Split(output, "\n"))
+}
+
+// write stores messages, falling back to the server log if the database is unavailable
+func (l *BuildLogger) write(stage, level string, messages []string) {
+	now := time.Now()
+	entries := make([]models.BuildLog, 0, len(messages))
+	for _, message := range messages {
+		entries = append(entries, models.BuildLog{
+			DeploymentID: l.deploymentID,
+			Stage:        stage,
+			Message:      strings.TrimRight(message, "\r"),
+			Level:        level,
+			Timestamp:    now,
+		})
+	}
+
+	if err := l.db.InsertBuildLogs(entries); err != nil {
+		log.Printf("Failed to store build logs for deployment %d: %v", l.deploymentID, err)
+		for _, entry := range entries {
+			log.Printf("[deployment %d] [%s] %s: %s", l.deploymentID, stage, level, entry.Message)
+		}
+	}
+
+	l.publish(models.EventLog, map[string]interface{}{
+		"stage":     stage,
+		"level":     level,
+		"messages":  messages,
+		"timestamp": now,
+	})
+}
+
+// publish emits a deployment event, logging rather than failing on error
+func (l *BuildLogger) publish(eventType string, data interface{}) {
+	if err := l.db.PublishEvent(l.deploymentID, eventType, data); err != nil {
+		log.Printf("Failed to publish %s event for deployment %d: %v", eventType, l.deploymentID, err)
+	}
+}
+
+// execStage runs a command in the container and records its stdout and stderr
+// in the build log. Dagger only returns output once the command has finished.
+func execStage(ctx context.Context, logger *BuildLogger, stage string, container *dagger.Container, args []string) (*dagger.Container, error) {
+	return runStage(ctx, logger, stage, container, args, args, nil)
+}
+
+// runStage runs args in the container, logging display as the command. filter,
+// if set, is given the stdout of the command and returns the part to record.
+func runStage(ctx context.Context, logger *BuildLogger, stage string, container *dagger.Container, display, args []string, filter func(stdout string) string) (*dagger.Container, error) {
+	logger.Info(stage, "$ %s", strings.Join(display, " "))
+	if filter == nil {
+		filter = func(stdout string) string { return stdout }
+	}
+
+	container, err := container.WithExec(args).Sync(ctx)
+	if err != nil {
+		var execErr *dagger.ExecError
+		if errors.As(err, &execErr) {
+			logger.Output(stage, models.LogLevelInfo, filter(execErr.Stdout))
+			logger.Output(stage, models.LogLevelWarn, execErr.Stderr)
+			logger.Error(stage, "command exited with code %d", execErr.ExitCode)
+			return nil, fmt.Errorf("%s exited with code %d", display[0], execErr.ExitCode)
+		}
+		logger.Error(stage, "%v", err)
+		return nil, err
+	}
+
+	stdout, err := container.Stdout(ctx)
+	if err == nil {
+		logger.Output(stage, models.LogLevelInfo, filter(stdout))
+	}
+	stderr, err := container.Stderr(ctx)
+	if err == nil {
+		logger.Output(stage, models.LogLevelWarn, stderr)
+	}
+
+	return container, nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"deploychain/models"
+)
+
+// solcImage is the image contracts are recompiled with, tagged by compiler release
+const solcImage = "ethereum/solc"
+
+// runtimeOutputSelection asks solc for the runtime code only. The output
+// selection does not change the code produced.
+const runtimeOutputSelection = `{"*":{"*":["evm.deployedBytecode.object","evm.deployedBytecode.immutableReferences"]}}`
+
+// recompiledContract is the runtime code solc produced for a contract
+type recompiledContract struct {
+	Code []byte
+	// Immutables are the ranges of Code holding immutable variables, zero
+	// until the constructor fills them in
+	Immutables []codeRange
+}
+
+// codeRange is a range of bytes in contract code
+type codeRange struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// Recompile compiles a standard-JSON input with the solc release of version
+// and returns the runtime code of every contract by "<source>:<Name>".
+// Contracts that need linking are left out.
+func (ds *DaggerService) Recompile(ctx context.Context, version, input string) (map[string]*recompiledContract, error) {
+	release, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), "+")
+	if release == "" {
+		return nil, fmt.Errorf("unknown compiler version")
+	}
+	input, err := withOutputSelection(input, runtimeOutputSelection)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := ds.client.Container().
+		From(solcImage+":"+release).
+		WithNewFile("/input.json", input).
+		WithExec([]string{"/usr/bin/solc", "--standard-json", "/input.json"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("solc %s failed: %v", release, err)
+	}
+
+	var output struct {
+		Errors []struct {
+			Severity         string `json:"severity"`
+			FormattedMessage string `json:"formattedMessage"`
+		} `json:"errors"`
+		Contracts map[string]map[string]struct {
+			EVM struct {
+				DeployedBytecode struct {
+					Object              string                 `json:"object"`
+					ImmutableReferences map[string][]codeRange `json:"immutableReferences"`
+				} `json:"deployedBytecode"`
+			} `json:"evm"`
+		} `json:"contracts"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil {
+		return nil, fmt.Errorf("invalid solc output: %v", err)
+	}
+	for _, e := range output.Errors {
+		if e.Severity == "error" {
+			return nil, fmt.Errorf("solc %s: %s", release, strings.TrimSpace(e.FormattedMessage))
+		}
+	}
+
+	recompiled := make(map[string]*recompiledContract)
+	for source, contracts := range output.Contracts {
+		for name, contract := range contracts {
+			// Unlinked library references are not valid hex
+			code, err := hex.DecodeString(contract.EVM.DeployedBytecode.Object)
+			if err != nil {
+				continue
+			}
+			var immutables []codeRange
+			for _, ranges := range contract.EVM.DeployedBytecode.ImmutableReferences {
+				immutables = append(immutables, ranges...)
+			}
+			recompiled[source+":"+name] = &recompiledContract{Code: code, Immutables: immutables}
+		}
+	}
+	return recompiled, nil
+}
+
+// withOutputSelection replaces the output selection of a standard-JSON input
+func withOutputSelection(input, selection string) (string, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &doc); err != nil {
+		return "", fmt.Errorf("invalid standard-JSON input: %v", err)
+	}
+	settings := make(map[string]json.RawMessage)
+	if raw, ok := doc["settings"]; ok {
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return "", fmt.Errorf("invalid standard-JSON settings: %v", err)
+		}
+	}
+	settings["outputSelection"] = json.RawMessage(selection)
+
+	var err error
+	if doc["settings"], err = json.Marshal(settings); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// compareRuntimeCode compares the code at a contract's address with its
+// recompilation. Immutable variables and the address libraries embed are
+// ignored, being set at deployment, and a partial match differs only in the
+// metadata hash.
+func compareRuntimeCode(deployed []byte, compiled *recompiledContract) string {
+	masked := append([]byte(nil), deployed...)
+	for _, r := range compiled.Immutables {
+		if r.Start >= 0 && r.Start+r.Length <= len(masked) {
+			copy(masked[r.Start:r.Start+r.Length], make([]byte, r.Length))
+		}
+	}
+	// Libraries start with PUSH20 of their own address, compiled as zeros
+	if isLibraryCode(compiled.Code) && len(masked) > 21 {
+		copy(masked[1:21], make([]byte, 20))
+	}
+
+	switch {
+	case bytes.Equal(masked, compiled.Code):
+		return models.BytecodeFullMatch
+	case bytes.Equal(stripMetadata(masked), stripMetadata(compiled.Code)):
+		return models.BytecodePartialMatch
+	default:
+		return models.BytecodeMismatch
+	}
+}
+
+// isLibraryCode reports whether runtime code starts with the call protection
+// of a library, a PUSH20 of the zero address
+func isLibraryCode(code []byte) bool {
+	return len(code) > 21 && code[0] == 0x73 && bytes.Equal(code[1:21], make([]byte, 20))
+}
+
+// stripMetadata removes the CBOR metadata solc appends to runtime code, its
+// length being encoded in the last two bytes
+func stripMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	n := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if n+2 > len(code) {
+		return code
+	}
+	return code[:len(code)-n-2]
+}
+
+// bytecodeCheck is the outcome of comparing a deployed contract with its recompilation
+type bytecodeCheck struct {
+	match   string
+	message string
+}
+
+// matchBytecode recompiles the deployed contracts from their standard-JSON
+// input and compares the result with the code at their address on every
+// network. Contracts compiled together are recompiled once.
+func (d *Deployer) matchBytecode(ctx context.Context, runs []*networkRun, contracts map[string]*models.CompiledContract, logger *BuildLogger) {
+	type compilation struct {
+		contracts map[string]*recompiledContract
+		err       error
+	}
+	compilations := make(map[[sha256.Size]byte]*compilation)
+	recompiled := make(map[string]*recompiledContract)
+	unchecked := make(map[string]string)
+	for name, contract := range contracts {
+		if contract.SourceCode == "" {
+			unchecked[name] = "no standard-JSON input, only Hardhat builds keep one"
+			continue
+		}
+		key := sha256.Sum256([]byte(contract.CompilerVersion + "\x00" + contract.SourceCode))
+		c, ok := compilations[key]
+		if !ok {
+			logger.Info(models.StageVerify, "Recompiling %s with solc %s", contract.SourcePath, contract.CompilerVersion)
+			c = &compilation{}
+			c.contracts, c.err = d.daggerService.Recompile(ctx, contract.CompilerVersion, contract.SourceCode)
+			if c.err != nil {
+				logger.Warn(models.StageVerify, "Recompilation failed: %v", c.err)
+			}
+			compilations[key] = c
+		}
+		switch {
+		case c.err != nil:
+			unchecked[name] = fmt.Sprintf("recompilation failed: %v", c.err)
+		case c.contracts[contract.SourcePath+":"+contract.Name] == nil:
+			unchecked[name] = "not in the recompilation output, libraries must be linked"
+		default:
+			recompiled[name] = c.contracts[contract.SourcePath+":"+contract.Name]
+		}
+	}
+
+	forEachRun(runs, func(run *networkRun) {
+		network := run.network
+		for _, deployed := range run.contracts {
+			if ctx.Err() != nil {
+				return
+			}
+			if deployed.Address == "" {
+				continue
+			}
+
+			var check bytecodeCheck
+			if compiled, ok := recompiled[deployed.Name]; ok {
+				check = checkDeployedCode(ctx, run.backend, deployed.Address, compiled)
+			} else {
+				check = bytecodeCheck{match: models.BytecodeUnchecked, message: unchecked[deployed.Name]}
+			}
+			if err := d.db.UpdateContractBytecodeMatch(run.record.DeploymentID, network.Name, deployed.Name, check.match, check.message); err != nil {
+				log.Printf("Failed to record bytecode match of %s on %s: %v", deployed.Name, network.Name, err)
+			}
+
+			switch check.match {
+			case models.BytecodeFullMatch, models.BytecodePartialMatch:
+				logger.Info(models.StageVerify, "[%s] Code of %s at %s is a %s", network.Name, deployed.Name, deployed.Address, strings.ReplaceAll(check.match, "_", " "))
+			case models.BytecodeMismatch:
+				logger.Error(models.StageVerify, "[%s] Code of %s at %s does not match its sources: %s", network.Name, deployed.Name, deployed.Address, check.message)
+			default:
+				logger.Warn(models.StageVerify, "[%s] Code of %s not checked: %s", network.Name, deployed.Name, check.message)
+			}
+		}
+	})
+}
+
+// checkDeployedCode compares the code at an address with a recompiled contract
+func checkDeployedCode(ctx context.Context, backend ChainBackend, address string, compiled *recompiledContract) bytecodeCheck {
+	code, err := backend.GetCode(ctx, address)
+	if err != nil {
+		return bytecodeCheck{match: models.BytecodeUnchecked, message: fmt.Sprintf("failed to read code: %v", err)}
+	}
+	if len(code) == 0 {
+		return bytecodeCheck{match: models.BytecodeMismatch, message: "no code at the address"}
+	}
+	match := compareRuntimeCode(code, compiled)
+	if match == models.BytecodeMismatch {
+		return bytecodeCheck{match: match, message: fmt.Sprintf("%d bytes deployed, %d recompiled", len(code), len(compiled.Code))}
+	}
+	return bytecodeCheck{match: match}
+}
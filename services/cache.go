@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"deploychain/models"
+
+	"dagger.io/dagger"
+)
+
+// cacheReportPrefix starts the lines build commands print about the state of their caches
+const cacheReportPrefix = "deploychain-cache:"
+
+// installedMarker is written to a node_modules cache once dependencies were installed into it
+const installedMarker = ".deploychain-installed"
+
+// Download caches mounted into build containers
+const (
+	corepackPath         = "/cache/corepack"
+	hardhatCompilersPath = "/root/.cache/hardhat-nodejs"
+	// svm prefers ~/.svm to its XDG directory when it exists
+	svmPath = "/root/.svm"
+)
+
+// lockfiles are the lockfiles of each package manager, the first one found keys node_modules
+var lockfiles = map[string][]string{
+	PackageManagerNPM:  {"package-lock.json", "npm-shrinkwrap.json"},
+	PackageManagerYarn: {"yarn.lock"},
+	PackageManagerPNPM: {"pnpm-lock.yaml"},
+}
+
+// packageCaches are where each package manager is told to keep downloaded packages
+var packageCaches = map[string]struct{ path, env string }{
+	PackageManagerNPM:  {"/cache/npm", "npm_config_cache"},
+	PackageManagerYarn: {"/cache/yarn", "YARN_CACHE_FOLDER"},
+	PackageManagerPNPM: {"/cache/pnpm", "npm_config_store_dir"},
+}
+
+// buildCache is a Dagger cache volume mounted into a build step
+type buildCache struct {
+	// name identifies the cache in build logs, unnamed caches are not reported
+	name   string
+	path   string
+	volume string
+	// locked caches are used by one build at a time
+	locked bool
+}
+
+// stepCaches are the cache volumes of a build step. The first command run with
+// them reports which are warm.
+type stepCaches struct {
+	repoKey string
+	mounts  []buildCache
+	env     map[string]string
+	// marker records that the node_modules caches hold the dependencies of
+	// lockfile, both are empty when there is no lockfile to key them by
+	marker   string
+	lockfile string
+	reported bool
+}
+
+// newStepCaches returns the caches of a build step of a repository, empty until added to
+func newStepCaches(repository string) *stepCaches {
+	return &stepCaches{repoKey: cacheKey(repository), env: make(map[string]string)}
+}
+
+// cacheKey shortens a value to a part of a cache volume key
+func cacheKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:6])
+}
+
+// add mounts a cache volume shared by the builds of the repository
+func (c *stepCaches) add(name, kind, mountPath string) {
+	c.mounts = append(c.mounts, buildCache{
+		name:   name,
+		path:   mountPath,
+		volume: fmt.Sprintf("deploychain-%s-%s", kind, c.repoKey),
+	})
+}
+
+// nodeCaches returns the caches of a Node.js build step with the repository
+// mounted at mount and dependencies installed for pkgPath. The node_modules
+// directories the install fills are keyed by the lockfile, so an unchanged
+// lockfile needs no install, while the download cache of the package manager
+// is kept across lockfile changes.
+func (ds *DaggerService) nodeCaches(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, mount, pkgPath string, logger *BuildLogger, stage string) *stepCaches {
+	caches := newStepCaches(layout.Repository)
+	download := packageCaches[layout.PackageManager]
+	caches.add(layout.PackageManager+" cache", layout.PackageManager, download.path)
+	caches.env[download.env] = download.path
+	if layout.PackageManager != PackageManagerNPM {
+		caches.add("corepack", "corepack", corepackPath)
+		caches.env["COREPACK_HOME"] = corepackPath
+	}
+
+	installDir := layout.InstallDir(pkgPath)
+	lockfile, hash := findLockfile(ctx, subdirectory(repo, installDir), layout.PackageManager)
+	if lockfile == "" {
+		logger.Warn(stage, "No lockfile in %s, dependencies are installed without a node_modules cache", installDir)
+		return caches
+	}
+	caches.lockfile = path.Join(installDir, lockfile)
+	caches.marker = containerPath(mount, path.Join(installDir, "node_modules", installedMarker))
+	logger.Info(stage, "Caching node_modules by %s (%s)", caches.lockfile, hash)
+
+	// Workspace installs may also fill the node_modules of every package
+	dirs := []string{installDir}
+	if layout.Workspaces {
+		dirs = append(dirs, layout.Packages...)
+		dirs = append(dirs, pkgPath)
+	}
+	sort.Strings(dirs)
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		caches.mounts = append(caches.mounts, buildCache{
+			path:   containerPath(mount, path.Join(dir, "node_modules")),
+			volume: fmt.Sprintf("deploychain-node-modules-%s-%s-%s", caches.repoKey, hash, cacheKey(dir)),
+			locked: true,
+		})
+	}
+	return caches
+}
+
+// findLockfile returns the lockfile of the package manager in dir and a key of
+// its contents, or empty strings if there is none
+func findLockfile(ctx context.Context, dir *dagger.Directory, packageManager string) (string, string) {
+	for _, name := range lockfiles[packageManager] {
+		contents, err := dir.File(name).Contents(ctx)
+		if err == nil {
+			return name, cacheKey(contents)
+		}
+	}
+	return "", ""
+}
+
+// mount adds the cache volumes and the environment pointing tools at them to a container
+func (c *stepCaches) mount(client *dagger.Client, container *dagger.Container) *dagger.Container {
+	for _, cache := range c.mounts {
+		opts := dagger.ContainerWithMountedCacheOpts{Sharing: dagger.CacheSharingModeShared}
+		if cache.locked {
+			opts.Sharing = dagger.CacheSharingModeLocked
+		}
+		container = container.WithMountedCache(cache.path, client.CacheVolume(cache.volume), opts)
+	}
+
+	// Sorted so identical caches produce identical, cacheable containers
+	names := make([]string, 0, len(c.env))
+	for name := range c.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container = container.WithEnvVariable(name, c.env[name])
+	}
+	return container
+}
+
+// installDependencies runs the install step of a Node.js build. The default
+// install is skipped when node_modules is up to date with the lockfile, a
+// custom one may do more and always runs.
+func installDependencies(ctx context.Context, logger *BuildLogger, stage string, container *dagger.Container, layout *ProjectLayout, settings models.BuildSettings, caches *stepCaches) (*dagger.Container, error) {
+	return caches.run(ctx, logger, stage, container, layout.installCommandFor(settings), settings.Install == "")
+}
+
+// run runs a command of the step and records the cache hits and misses in the
+// build log. An install command is skipped when the node_modules caches hold
+// the dependencies of the lockfile.
+func (c *stepCaches) run(ctx context.Context, logger *BuildLogger, stage string, container *dagger.Container, args []string, install bool) (*dagger.Container, error) {
+	install = install && c.marker != ""
+	container, err := runStage(ctx, logger, stage, container, args, c.script(args, install), func(stdout string) string {
+		var hits, misses, rest []string
+		for _, line := range strings.Split(stdout, "\n") {
+			report, ok := strings.CutPrefix(line, cacheReportPrefix+" ")
+			if !ok {
+				rest = append(rest, line)
+			} else if name, ok := strings.CutPrefix(report, "hit "); ok {
+				hits = append(hits, name)
+			} else {
+				misses = append(misses, strings.TrimPrefix(report, "miss "))
+			}
+		}
+		if len(hits) > 0 {
+			logger.Info(stage, "Cache hit: %s", strings.Join(hits, ", "))
+		}
+		if len(misses) > 0 {
+			logger.Info(stage, "Cache miss: %s", strings.Join(misses, ", "))
+		}
+		if install && slices.Contains(hits, "node_modules") {
+			logger.Info(stage, "Dependencies of %s already installed, skipping installation", c.lockfile)
+		}
+		return strings.Join(rest, "\n")
+	})
+	c.reported = true
+	return container, err
+}
+
+// script wraps a command in a shell script reporting the state of the caches
+// unless done before. An install command exits early when the node_modules
+// caches are marked as installed, and marks them once it succeeds.
+func (c *stepCaches) script(args []string, install bool) []string {
+	var lines []string
+	if !c.reported {
+		if c.marker != "" {
+			lines = append(lines, cacheReport("node_modules", "[ -f "+shellQuote(c.marker)+" ]"))
+		}
+		for _, cache := range c.mounts {
+			if cache.name != "" {
+				lines = append(lines, cacheReport(cache.name, `[ -n "$(ls -A `+shellQuote(cache.path)+` 2>/dev/null)" ]`))
+			}
+		}
+	}
+	if install {
+		lines = append(lines,
+			"[ -f "+shellQuote(c.marker)+" ] && exit 0",
+			`"$@" || exit $?`,
+			// Yarn Plug'n'Play installs into the repository, which is not cached
+			"[ -e .pnp.cjs ] || touch "+shellQuote(c.marker))
+	} else {
+		lines = append(lines, `exec "$@"`)
+	}
+	return append([]string{"sh", "-c", strings.Join(lines, "\n"), "sh"}, args...)
+}
+
+// cacheReport returns a shell command printing whether a cache passes test
+func cacheReport(name, test string) string {
+	return fmt.Sprintf("if %s; then echo %s; else echo %s; fi", test,
+		shellQuote(cacheReportPrefix+" hit "+name), shellQuote(cacheReportPrefix+" miss "+name))
+}
+
+// shellQuote quotes a string for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"deploychain/models"
+
+	multibaas "github.com/curvegrid/multibaas-sdk-go"
+)
+
+// receiptPollInterval is how often receipts are polled while waiting for a transaction
+const receiptPollInterval = 3 * time.Second
+
+// ChainBackend deploys and reads contracts on a single network
+type ChainBackend interface {
+	// Name identifies the kind of backend in logs, e.g. "multibaas"
+	Name() string
+	// Status returns the chain ID and latest block of the network
+	Status(ctx context.Context) (*ChainStatus, error)
+	// DeployerAddress returns the address deployment transactions are sent from
+	DeployerAddress(ctx context.Context) (string, error)
+	// DeployContract submits the creation transaction of a contract. args are
+	// constructor arguments as returned by encodeConstructorArgs.
+	DeployContract(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*SubmittedTx, error)
+	// SendTransaction signs a fully built transaction with the local signer and
+	// broadcasts it, used to replace a pending transaction
+	SendTransaction(ctx context.Context, tx *UnsignedTx) (string, error)
+	// EstimateDeployGas estimates the gas the creation transaction of a contract
+	// uses and the price it would pay per gas at current fee levels
+	EstimateDeployGas(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*GasEstimate, error)
+	// CallContract calls a read-only function of a deployed contract
+	CallContract(ctx context.Context, address string, contract *models.CompiledContract, method string, args []interface{}) (interface{}, error)
+	// GetTransactionReceipt returns the receipt of a transaction, or nil if it is not mined
+	GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error)
+	// GetCode returns the runtime bytecode at an address, empty for accounts without code
+	GetCode(ctx context.Context, address string) ([]byte, error)
+}
+
+// ChainStatus is the state of a network as reported by its backend
+type ChainStatus struct {
+	ChainID     int64
+	BlockNumber int64
+}
+
+// SubmittedTx is a transaction accepted by the network
+type SubmittedTx struct {
+	Hash string
+	From string
+	// GasPrice is the price per gas offered, used for the cost when the receipt
+	// has no effective gas price
+	GasPrice *big.Int
+	// Tx is the transaction as signed locally, nil when the node or MultiBaas
+	// signed it. Only locally signed transactions can be replaced.
+	Tx *UnsignedTx
+}
+
+// GasEstimate is the projected gas use and price of a transaction
+type GasEstimate struct {
+	Gas      uint64
+	GasPrice *big.Int
+}
+
+// Receipt is a mined transaction
+type Receipt struct {
+	TxHash            string
+	BlockHash         string
+	BlockNumber       int64
+	ContractAddress   string
+	GasUsed           int64
+	EffectiveGasPrice *big.Int
+	// Status is 1 for success and 0 for a reverted transaction
+	Status int64
+}
+
+// ChainBackends selects the backend of each network. Networks with an RPC URL
+// are reached over JSON-RPC, all others through MultiBaas.
+type ChainBackends struct {
+	multibaas *BlockchainService
+	signer    Signer
+	nonces    *NonceManager
+	networks  *NetworkRegistry
+
+	mu  sync.Mutex
+	rpc map[string]*RPCBackend
+}
+
+// NewChainBackends creates the backend registry. signer signs JSON-RPC
+// transactions with nonces from nonces, without it they are sent from an
+// account unlocked on the node.
+func NewChainBackends(multibaas *BlockchainService, signer Signer, nonces *NonceManager, networks *NetworkRegistry) *ChainBackends {
+	return &ChainBackends{
+		multibaas: multibaas,
+		signer:    signer,
+		nonces:    nonces,
+		networks:  networks,
+		rpc:       make(map[string]*RPCBackend),
+	}
+}
+
+// Backend returns the backend deploying to a network
+func (b *ChainBackends) Backend(network *models.Network) ChainBackend {
+	if network.RPCURL == "" {
+		return b.multibaas.Backend(multibaas.ChainName(network.MultiBaasChain))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Keep one client per network so the chain ID is only looked up once
+	if backend, ok := b.rpc[network.Name]; ok {
+		return backend
+	}
+	backend := NewRPCBackend(network.RPCURL, b.signer, b.nonces, os.Getenv(networkEnv("RPC_FROM_", network.Name)))
+	b.rpc[network.Name] = backend
+	return backend
+}
+
+// TestConnection checks MultiBaas, when configured, on the default network and
+// every JSON-RPC network
+func (b *ChainBackends) TestConnection(ctx context.Context) error {
+	for _, network := range b.networks.List() {
+		if network.RPCURL == "" && (network.Name != b.networks.Default() || os.Getenv("MB_BASE_URL") == "") {
+			continue
+		}
+		if _, err := b.Backend(&network).Status(ctx); err != nil {
+			return fmt.Errorf("%s: %v", network.Name, err)
+		}
+	}
+	return nil
+}
+
+// networkEnv returns the name of a per-network environment variable, e.g. RPC_URL_SEPOLIA
+func networkEnv(prefix, network string) string {
+	return prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - ('a' - 'A')
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, network)
+}
+
+// rpcNetworks returns the networks with a JSON-RPC endpoint, lowercased
+func rpcNetworks() []string {
+	var networks []string
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "RPC_URL_") && value != "" {
+			networks = append(networks, strings.ToLower(strings.TrimPrefix(name, "RPC_URL_")))
+		}
+	}
+	sort.Strings(networks)
+	return networks
+}
+
+// receiptTimeout is how long a transaction may go without a receipt
+func receiptTimeout() time.Duration {
+	return time.Duration(envInt("RECEIPT_TIMEOUT_SECONDS", 300)) * time.Second
+}
+
+// DeployContracts deploys the targets in order, resolving ${Name.address}
+// references in constructor arguments from earlier targets. Each contract's
+// address, gas used and cost are read from its mined receipt before the next
+// one is sent, transactions being recorded and sped up by txs. Nothing is sent
+// if the backend is connected to a chain other than the network's.
+// On failure or cancellation, the contracts deployed so far are returned with the
+// error, including a reverted deployment since its gas was still paid for.
+// A job resumed after its worker died continues from the progress txs recorded:
+// deployed contracts are kept and submitted transactions waited for, nothing
+// is sent twice.
+func DeployContracts(ctx context.Context, backend ChainBackend, network *models.Network, targets []DeployTarget, txs *TxSession) ([]models.ContractDeployment, error) {
+	var deployed []models.ContractDeployment
+	addresses := make(models.ContractAddressMap)
+
+	status, err := checkChainID(ctx, backend, network)
+	if err != nil {
+		return nil, err
+	}
+	earlier, err := txs.Resume()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read earlier progress of %s: %v", network.Name, err)
+	}
+
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return deployed, err
+		}
+		contractLabel := target.Name
+		contract := target.Contract
+
+		// Prepare constructor arguments for deployment
+		args, err := resolveAddressRefs(target.Args, addresses)
+		if err != nil {
+			return deployed, fmt.Errorf("constructor arguments for %s: %v", contractLabel, err)
+		}
+		constructorArgs, err := encodeConstructorArgs(contract.ABI, args)
+		if err != nil {
+			return deployed, fmt.Errorf("constructor arguments for %s: %v", contractLabel, err)
+		}
+		argsData, err := constructorArgsData(contract, constructorArgs)
+		if err != nil {
+			return deployed, fmt.Errorf("constructor arguments for %s: %v", contractLabel, err)
+		}
+
+		record := models.ContractDeployment{
+			Name:            contractLabel,
+			Network:         network.Name,
+			ChainID:         status.ChainID,
+			ConstructorArgs: hex.EncodeToString(argsData),
+		}
+		var tx *SubmittedTx
+		switch previous := earlier[contractLabel]; previous.Status {
+		case models.ContractStatusDeployed:
+			txs.logger.Info(models.StageDeploy, "[%s] %s was deployed at %s before the job was resumed",
+				network.Name, contractLabel, previous.Address)
+			deployed = append(deployed, previous)
+			addresses[contractLabel] = previous.Address
+			continue
+		case models.ContractStatusReverted:
+			deployed = append(deployed, previous)
+			return deployed, fmt.Errorf("deployment transaction %s for contract %s reverted", previous.TransactionHash, contractLabel)
+		case models.ContractStatusSending:
+			// The worker died between recording and sending, a second creation
+			// transaction could deploy the contract twice
+			return deployed, fmt.Errorf("contract %s may have been sent before the job was interrupted, check the deployer account before deploying again", contractLabel)
+		case models.ContractStatusSubmitted:
+			txs.logger.Info(models.StageDeploy, "[%s] Waiting for transaction %s of %s, sent before the job was resumed",
+				network.Name, previous.TransactionHash, contractLabel)
+			tx = &SubmittedTx{Hash: previous.TransactionHash}
+			tx.GasPrice, _ = new(big.Int).SetString(previous.EffectiveGasPrice, 10)
+		default:
+			record.Status = models.ContractStatusSending
+			record.DeployedAt = time.Now()
+			if err := txs.Progress(record); err != nil {
+				return deployed, fmt.Errorf("failed to record deployment of %s: %v", contractLabel, err)
+			}
+			tx, err = backend.DeployContract(ctx, contract, constructorArgs)
+			if err != nil {
+				if ctx.Err() != nil {
+					return deployed, ctx.Err()
+				}
+				return deployed, fmt.Errorf("deployment failed for contract %s: %w", contractLabel, err)
+			}
+
+			if err := txs.Sent(contractLabel, tx); err != nil {
+				log.Printf("Failed to record transaction %s: %v", tx.Hash, err)
+			}
+			// The offered gas price is kept for the cost of a resumed wait
+			record.Status = models.ContractStatusSubmitted
+			record.TransactionHash = tx.Hash
+			if tx.GasPrice != nil {
+				record.EffectiveGasPrice = tx.GasPrice.String()
+			}
+			if err := txs.Progress(record); err != nil {
+				log.Printf("Failed to record submission of %s: %v", contractLabel, err)
+			}
+		}
+
+		// The contract address and gas used are only known once the transaction is mined
+		receipt, err := txs.WaitForReceipt(ctx, backend, tx.Hash)
+		if err != nil {
+			if ctx.Err() != nil {
+				return deployed, ctx.Err()
+			}
+			return deployed, fmt.Errorf("deployment of contract %s: %w", contractLabel, err)
+		}
+		gasPrice, cost, err := receiptCost(receipt, tx.GasPrice)
+		if err != nil {
+			return deployed, fmt.Errorf("deployment of contract %s: %v", contractLabel, err)
+		}
+
+		// A replacement may have been mined instead of the transaction sent
+		record.TransactionHash = tx.Hash
+		if receipt.TxHash != "" {
+			record.TransactionHash = receipt.TxHash
+		}
+		record.BlockNumber = receipt.BlockNumber
+		record.GasUsed = receipt.GasUsed
+		record.EffectiveGasPrice = gasPrice.String()
+		record.CostWei = cost.String()
+		record.Cost = FormatUnits(cost.String(), network.NativeCurrency.Decimals)
+		record.Status = models.ContractStatusDeployed
+		record.DeployedAt = time.Now()
+		txHash := record.TransactionHash
+		if receipt.Status != 1 {
+			record.Status = models.ContractStatusReverted
+			deployed = append(deployed, record)
+			return deployed, fmt.Errorf("deployment transaction %s for contract %s reverted", txHash, contractLabel)
+		}
+		if receipt.ContractAddress == "" {
+			return deployed, fmt.Errorf("receipt of %s has no contract address for %s", txHash, contractLabel)
+		}
+		record.Address = receipt.ContractAddress
+		deployed = append(deployed, record)
+		addresses[contractLabel] = receipt.ContractAddress
+	}
+
+	return deployed, nil
+}
+
+// checkChainID returns the status of the backend, failing if it is connected
+// to a chain other than the network's
+func checkChainID(ctx context.Context, backend ChainBackend, network *models.Network) (*ChainStatus, error) {
+	status, err := backend.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of %s: %v", network.Name, err)
+	}
+	if network.ChainID != 0 && status.ChainID != network.ChainID {
+		return nil, fmt.Errorf("%s backend is connected to chain ID %d, %s has chain ID %d",
+			backend.Name(), status.ChainID, network.Name, network.ChainID)
+	}
+	return status, nil
+}
+
+// EstimateContracts projects the gas and cost of deploying the targets at the
+// network's current fee levels without sending any transaction. The contracts
+// referenced in constructor arguments have no address yet, references resolve
+// to the deployer address instead. Contracts that cannot be estimated are left
+// out and their errors returned together.
+func EstimateContracts(ctx context.Context, backend ChainBackend, network *models.Network, deployer string, targets []DeployTarget) ([]models.ContractDeployment, error) {
+	status, err := checkChainID(ctx, backend, network)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := make(models.ContractAddressMap)
+	for _, target := range targets {
+		placeholders[target.Name] = deployer
+	}
+
+	var estimated []models.ContractDeployment
+	var failures []string
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return estimated, err
+		}
+		args, err := resolveAddressRefs(target.Args, placeholders)
+		if err == nil {
+			args, err = encodeConstructorArgs(target.Contract.ABI, args)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("constructor arguments for %s: %v", target.Name, err))
+			continue
+		}
+
+		estimate, err := backend.EstimateDeployGas(ctx, target.Contract, args)
+		if err != nil {
+			if ctx.Err() != nil {
+				return estimated, ctx.Err()
+			}
+			failures = append(failures, fmt.Sprintf("gas estimation failed for contract %s: %v", target.Name, err))
+			continue
+		}
+		if estimate.GasPrice == nil {
+			failures = append(failures, fmt.Sprintf("no gas price for contract %s", target.Name))
+			continue
+		}
+		cost := new(big.Int).Mul(new(big.Int).SetUint64(estimate.Gas), estimate.GasPrice)
+
+		estimated = append(estimated, models.ContractDeployment{
+			Name:              target.Name,
+			GasUsed:           int64(estimate.Gas),
+			EffectiveGasPrice: estimate.GasPrice.String(),
+			CostWei:           cost.String(),
+			Cost:              FormatUnits(cost.String(), network.NativeCurrency.Decimals),
+			Network:           network.Name,
+			ChainID:           status.ChainID,
+			BlockNumber:       status.BlockNumber,
+			Status:            models.ContractStatusEstimated,
+			DeployedAt:        time.Now(),
+		})
+	}
+
+	if len(failures) > 0 {
+		return estimated, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return estimated, nil
+}
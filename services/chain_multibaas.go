@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"deploychain/models"
+
+	multibaas "github.com/curvegrid/multibaas-sdk-go"
+)
+
+// multiBaasBackend is the ChainBackend of a chain reached through MultiBaas
+type multiBaasBackend struct {
+	service *BlockchainService
+	chain   multibaas.ChainName
+}
+
+// Backend returns the ChainBackend deploying to chain through MultiBaas
+func (bs *BlockchainService) Backend(chain multibaas.ChainName) ChainBackend {
+	return &multiBaasBackend{service: bs, chain: chain}
+}
+
+func (b *multiBaasBackend) Name() string {
+	return "multibaas"
+}
+
+func (b *multiBaasBackend) Status(ctx context.Context) (*ChainStatus, error) {
+	resp, err := b.service.GetChainStatus(ctx, b.chain)
+	if err != nil {
+		return nil, b.service.HandleMultiBaasError(err)
+	}
+	return &ChainStatus{ChainID: resp.Result.ChainID, BlockNumber: resp.Result.BlockNumber}, nil
+}
+
+func (b *multiBaasBackend) DeployerAddress(ctx context.Context) (string, error) {
+	from := b.service.DeployerAddress()
+	if from == "" {
+		return "", fmt.Errorf("no deployer configured, set SIGNER_KEYSTORE or MB_DEPLOYER_ADDRESS")
+	}
+	return from, nil
+}
+
+// DeployContract uploads the contract to the MultiBaas library and deploys it
+func (b *multiBaasBackend) DeployContract(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*SubmittedTx, error) {
+	label, version, err := b.service.UploadContract(ctx, contract)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	deployTx, signed, err := b.service.DeployContract(ctx, b.chain, label, version, args)
+	if err != nil {
+		return nil, err
+	}
+	tx := deployTx.Tx
+	if !deployTx.Submitted || tx.Hash == nil || *tx.Hash == "" {
+		return nil, fmt.Errorf("deployment transaction was not submitted")
+	}
+
+	submitted := &SubmittedTx{Hash: *tx.Hash, From: tx.From, Tx: signed}
+	// Dynamic fee transactions pay at most the fee cap
+	for _, price := range []*string{tx.GasPrice, tx.GasFeeCap} {
+		if price != nil {
+			if n, ok := parseAmount(*price); ok {
+				submitted.GasPrice = n
+				break
+			}
+		}
+	}
+	return submitted, nil
+}
+
+// SendTransaction signs a transaction locally and submits it through MultiBaas
+func (b *multiBaasBackend) SendTransaction(ctx context.Context, tx *UnsignedTx) (string, error) {
+	return b.service.SubmitTransaction(ctx, b.chain, tx)
+}
+
+// EstimateDeployGas asks MultiBaas to build the deployment transaction without
+// submitting it and returns its gas limit and price, which MultiBaas estimates.
+// Dynamic fee transactions are priced at their fee cap, an upper bound.
+func (b *multiBaasBackend) EstimateDeployGas(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*GasEstimate, error) {
+	from, err := b.DeployerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	label, version, err := b.service.UploadContract(ctx, contract)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+
+	signAndSubmit := false
+	request := multibaas.PostMethodArgs{
+		Args:          args,
+		From:          &from,
+		SignAndSubmit: &signAndSubmit,
+	}
+	resp, _, err := b.service.client.ContractsAPI.DeployContractByVersion(b.service.authContext(ctx), label, version).PostMethodArgs(request).Execute()
+	if err != nil {
+		return nil, b.service.HandleMultiBaasError(err)
+	}
+	tx := resp.Result.Tx
+	estimate := &GasEstimate{Gas: uint64(tx.Gas)}
+	for _, price := range []*string{tx.GasPrice, tx.GasFeeCap} {
+		if price != nil {
+			if n, ok := parseAmount(*price); ok {
+				estimate.GasPrice = n
+				break
+			}
+		}
+	}
+	return estimate, nil
+}
+
+// CallContract calls a function of a contract uploaded under its library label
+func (b *multiBaasBackend) CallContract(ctx context.Context, address string, contract *models.CompiledContract, method string, args []interface{}) (interface{}, error) {
+	resp, err := b.service.CallContractFunction(ctx, b.chain, address, contractLabel(contract.Name), method, args)
+	if err != nil {
+		return nil, b.service.HandleMultiBaasError(err)
+	}
+	if resp.Result.MethodCallResponse == nil {
+		return nil, fmt.Errorf("%s is not a read-only function", method)
+	}
+	return resp.Result.MethodCallResponse.Output, nil
+}
+
+func (b *multiBaasBackend) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	r, err := b.service.GetTransactionReceipt(ctx, b.chain, txHash)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	gasUsed, ok := parseAmount(r.GasUsed)
+	if !ok || !gasUsed.IsInt64() {
+		return nil, fmt.Errorf("invalid gas used %q in receipt of %s", r.GasUsed, txHash)
+	}
+	receipt := &Receipt{
+		TxHash:      r.TxHash,
+		BlockHash:   r.BlockHash,
+		BlockNumber: r.BlockNumber,
+		GasUsed:     gasUsed.Int64(),
+		Status:      r.Status,
+	}
+	if address := r.ContractAddress.Get(); address != nil {
+		receipt.ContractAddress = *address
+	}
+	if r.EffectiveGasPrice != nil {
+		if price, ok := parseAmount(*r.EffectiveGasPrice); ok {
+			receipt.EffectiveGasPrice = price
+		}
+	}
+	return receipt, nil
+}
+
+// GetCode reads the code MultiBaas reports for an address
+func (b *multiBaasBackend) GetCode(ctx context.Context, address string) ([]byte, error) {
+	resp, _, err := b.service.client.AddressesAPI.GetAddress(b.service.authContext(ctx), b.chain, address).Execute()
+	if err != nil {
+		return nil, b.service.HandleMultiBaasError(err)
+	}
+	code, err := hex.DecodeString(strings.TrimPrefix(resp.Result.CodeAt, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid code at %s: %v", address, err)
+	}
+	return code, nil
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"deploychain/models"
+)
+
+// gasLimitMargin is added to gas estimates, in percent, since the state may
+// change between the estimate and the transaction being mined
+const gasLimitMargin = 20
+
+// RPCBackend is the ChainBackend of a network reached through a plain Ethereum
+// JSON-RPC endpoint, such as a local Anvil or Hardhat node
+type RPCBackend struct {
+	url    string
+	client *http.Client
+	signer Signer
+	nonces *NonceManager
+	from   string
+	nextID atomic.Int64
+
+	mu      sync.Mutex
+	chainID *big.Int
+}
+
+// NewRPCBackend creates a JSON-RPC backend. Transactions are signed with signer,
+// using nonces from nonces, or without one sent from the node's account from,
+// by default its first account.
+func NewRPCBackend(url string, signer Signer, nonces *NonceManager, from string) *RPCBackend {
+	return &RPCBackend{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+		signer: signer,
+		nonces: nonces,
+		from:   from,
+	}
+}
+
+// rpcError is the error member of a JSON-RPC response
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	if len(e.Data) > 0 && string(e.Data) != "null" {
+		return fmt.Sprintf("%s (code %d, data %s)", e.Message, e.Code, e.Data)
+	}
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// call invokes a JSON-RPC method and decodes its result into result
+func (b *RPCBackend) call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      b.nextID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: invalid response (HTTP %d): %v", method, resp.StatusCode, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %w", method, response.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// hexQuantity formats an integer as a JSON-RPC quantity
+func hexQuantity(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+// callQuantity invokes a method returning a quantity
+func (b *RPCBackend) callQuantity(ctx context.Context, method string, params ...interface{}) (*big.Int, error) {
+	var result string
+	if err := b.call(ctx, &result, method, params...); err != nil {
+		return nil, err
+	}
+	n, ok := parseAmount(result)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid quantity %q", method, result)
+	}
+	return n, nil
+}
+
+func (b *RPCBackend) Name() string {
+	return "json-rpc"
+}
+
+// ChainID returns the chain ID of the node, cached after the first lookup
+func (b *RPCBackend) ChainID(ctx context.Context) (*big.Int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.chainID != nil {
+		return b.chainID, nil
+	}
+	id, err := b.callQuantity(ctx, "eth_chainId")
+	if err != nil {
+		return nil, err
+	}
+	b.chainID = id
+	return id, nil
+}
+
+func (b *RPCBackend) Status(ctx context.Context) (*ChainStatus, error) {
+	chainID, err := b.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head, err := b.callQuantity(ctx, "eth_blockNumber")
+	if err != nil {
+		return nil, err
+	}
+	return &ChainStatus{ChainID: chainID.Int64(), BlockNumber: head.Int64()}, nil
+}
+
+func (b *RPCBackend) DeployerAddress(ctx context.Context) (string, error) {
+	if b.signer != nil {
+		return b.signer.Address(), nil
+	}
+	if b.from != "" {
+		return b.from, nil
+	}
+	var accounts []string
+	if err := b.call(ctx, &accounts, "eth_accounts"); err != nil {
+		return "", err
+	}
+	if len(accounts) == 0 {
+		return "", fmt.Errorf("node has no unlocked accounts, set SIGNER_KEYSTORE to sign transactions")
+	}
+	return accounts[0], nil
+}
+
+// creationData returns the bytecode of a contract followed by its ABI-encoded constructor arguments
+func creationData(contract *models.CompiledContract, args []interface{}) ([]byte, error) {
+	code, err := hex.DecodeString(strings.TrimPrefix(contract.Bytecode, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %v", err)
+	}
+	encoded, err := constructorArgsData(contract, args)
+	if err != nil {
+		return nil, err
+	}
+	return append(code, encoded...), nil
+}
+
+// constructorArgsData returns the ABI encoding of constructor arguments, as
+// appended to the bytecode of a creation transaction
+func constructorArgsData(contract *models.CompiledContract, args []interface{}) ([]byte, error) {
+	inputs, err := constructorInputs(contract.ABI)
+	if err != nil {
+		return nil, err
+	}
+	types, err := parseABIArguments(inputs)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := abiEncode(types, args)
+	if err != nil {
+		return nil, fmt.Errorf("constructor arguments: %v", err)
+	}
+	return encoded, nil
+}
+
+// rpcTransaction is a transaction object of eth_call, eth_estimateGas and eth_sendTransaction
+type rpcTransaction struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	Gas  string `json:"gas,omitempty"`
+	Data string `json:"data"`
+}
+
+// EstimateDeployGas estimates the creation transaction with eth_estimateGas and
+// prices it with eth_gasPrice, which includes the base fee on EIP-1559 networks
+func (b *RPCBackend) EstimateDeployGas(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*GasEstimate, error) {
+	from, err := b.DeployerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := creationData(contract, args)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := b.estimateGas(ctx, rpcTransaction{From: from, Data: "0x" + hex.EncodeToString(data)})
+	if err != nil {
+		return nil, err
+	}
+	price, err := b.callQuantity(ctx, "eth_gasPrice")
+	if err != nil {
+		return nil, err
+	}
+	return &GasEstimate{Gas: gas, GasPrice: price}, nil
+}
+
+func (b *RPCBackend) estimateGas(ctx context.Context, tx rpcTransaction) (uint64, error) {
+	gas, err := b.callQuantity(ctx, "eth_estimateGas", tx)
+	if err != nil {
+		return 0, err
+	}
+	if !gas.IsUint64() {
+		return 0, fmt.Errorf("invalid gas estimate %s", gas)
+	}
+	return gas.Uint64(), nil
+}
+
+// DeployContract sends the creation transaction, signed locally when a signer is
+// configured and by the node otherwise
+func (b *RPCBackend) DeployContract(ctx context.Context, contract *models.CompiledContract, args []interface{}) (*SubmittedTx, error) {
+	from, err := b.DeployerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := creationData(contract, args)
+	if err != nil {
+		return nil, err
+	}
+	estimate, err := b.estimateGas(ctx, rpcTransaction{From: from, Data: "0x" + hex.EncodeToString(data)})
+	if err != nil {
+		return nil, fmt.Errorf("gas estimation failed: %w", err)
+	}
+	gas := estimate + estimate*gasLimitMargin/100
+
+	if b.signer == nil {
+		var hash string
+		tx := rpcTransaction{From: from, Gas: hexQuantity(new(big.Int).SetUint64(gas)), Data: "0x" + hex.EncodeToString(data)}
+		if err := b.call(ctx, &hash, "eth_sendTransaction", tx); err != nil {
+			return nil, err
+		}
+		return &SubmittedTx{Hash: hash}, nil
+	}
+
+	tx, lease, err := b.newTransaction(ctx, from, gas, data)
+	if err != nil {
+		return nil, err
+	}
+	raw, hash, err := b.signer.SignTransaction(tx)
+	if err != nil {
+		lease.Release()
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	if err := b.call(ctx, nil, "eth_sendRawTransaction", "0x"+hex.EncodeToString(raw)); err != nil {
+		lease.Release()
+		return nil, err
+	}
+	lease.Commit()
+
+	submitted := &SubmittedTx{Hash: hash, From: from, GasPrice: tx.GasPrice, Tx: tx}
+	if tx.Type == TxTypeDynamicFee {
+		submitted.GasPrice = tx.GasFeeCap
+	}
+	return submitted, nil
+}
+
+// SendTransaction signs a transaction with the local signer and broadcasts it
+func (b *RPCBackend) SendTransaction(ctx context.Context, tx *UnsignedTx) (string, error) {
+	if b.signer == nil {
+		return "", fmt.Errorf("no local signer configured, set SIGNER_KEYSTORE")
+	}
+	raw, hash, err := b.signer.SignTransaction(tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	if err := b.call(ctx, nil, "eth_sendRawTransaction", "0x"+hex.EncodeToString(raw)); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// newTransaction fills in the fees and nonce of a contract creation. Networks
+// with a base fee get an EIP-1559 transaction, others a legacy one. The nonce
+// lease must be committed or released once the transaction is sent.
+func (b *RPCBackend) newTransaction(ctx context.Context, from string, gas uint64, data []byte) (*UnsignedTx, *NonceLease, error) {
+	chainID, err := b.ChainID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := &UnsignedTx{
+		ChainID: chainID,
+		Gas:     gas,
+		Data:    data,
+	}
+
+	var block struct {
+		BaseFeePerGas *string `json:"baseFeePerGas"`
+	}
+	if err := b.call(ctx, &block, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, nil, err
+	}
+	if block.BaseFeePerGas == nil {
+		tx.Type = TxTypeLegacy
+		if tx.GasPrice, err = b.callQuantity(ctx, "eth_gasPrice"); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		baseFee, ok := parseAmount(*block.BaseFeePerGas)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid base fee %q", *block.BaseFeePerGas)
+		}
+		tip, err := b.callQuantity(ctx, "eth_maxPriorityFeePerGas")
+		if err != nil {
+			return nil, nil, err
+		}
+		// Leave room for the base fee to double before the transaction is mined
+		tx.Type = TxTypeDynamicFee
+		tx.GasTipCap = tip
+		tx.GasFeeCap = new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+	}
+
+	// The nonce is allocated last so no lease is held while fees are looked up
+	pending, err := b.callQuantity(ctx, "eth_getTransactionCount", from, "pending")
+	if err != nil {
+		return nil, nil, err
+	}
+	lease, err := b.nonces.Acquire(chainID.Int64(), from, pending.Uint64())
+	if err != nil {
+		return nil, nil, err
+	}
+	tx.Nonce = lease.Nonce
+	return tx, lease, nil
+}
+
+// CallContract calls a function with eth_call and decodes its outputs. A single
+// output is returned as is, several as a list.
+func (b *RPCBackend) CallContract(ctx context.Context, address string, contract *models.CompiledContract, method string, args []interface{}) (interface{}, error) {
+	function, err := findFunction(contract.ABI, method, len(args))
+	if err != nil {
+		return nil, err
+	}
+	values, err := encodeArguments(function.Inputs, args)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := parseABIArguments(function.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := parseABIArguments(function.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := abiEncode(inputs, values)
+	if err != nil {
+		return nil, err
+	}
+	data := append(functionSelector(method, inputs), encoded...)
+
+	var result string
+	if err := b.call(ctx, &result, "eth_call", rpcTransaction{To: address, Data: "0x" + hex.EncodeToString(data)}, "latest"); err != nil {
+		return nil, err
+	}
+	returned, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid return data: %v", err)
+	}
+	decoded, err := abiDecode(outputs, returned)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", method, err)
+	}
+	if len(decoded) == 1 {
+		return decoded[0], nil
+	}
+	return decoded, nil
+}
+
+func (b *RPCBackend) GetCode(ctx context.Context, address string) ([]byte, error) {
+	var code string
+	if err := b.call(ctx, &code, "eth_getCode", address, "latest"); err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(code, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid code at %s: %v", address, err)
+	}
+	return data, nil
+}
+
+func (b *RPCBackend) GetTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var r *struct {
+		TransactionHash   string  `json:"transactionHash"`
+		BlockHash         string  `json:"blockHash"`
+		BlockNumber       string  `json:"blockNumber"`
+		ContractAddress   *string `json:"contractAddress"`
+		GasUsed           string  `json:"gasUsed"`
+		EffectiveGasPrice *string `json:"effectiveGasPrice"`
+		Status            string  `json:"status"`
+	}
+	if err := b.call(ctx, &r, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	// Pending transactions have no receipt
+	if r == nil || r.BlockNumber == "" {
+		return nil, nil
+	}
+
+	blockNumber, ok := parseAmount(r.BlockNumber)
+	if !ok {
+		return nil, fmt.Errorf("invalid block number %q in receipt of %s", r.BlockNumber, txHash)
+	}
+	gasUsed, ok := parseAmount(r.GasUsed)
+	if !ok || !gasUsed.IsInt64() {
+		return nil, fmt.Errorf("invalid gas used %q in receipt of %s", r.GasUsed, txHash)
+	}
+	status, ok := parseAmount(r.Status)
+	if !ok {
+		return nil, fmt.Errorf("invalid status %q in receipt of %s", r.Status, txHash)
+	}
+	receipt := &Receipt{
+		TxHash:      r.TransactionHash,
+		BlockHash:   r.BlockHash,
+		BlockNumber: blockNumber.Int64(),
+		GasUsed:     gasUsed.Int64(),
+		Status:      status.Int64(),
+	}
+	if r.ContractAddress != nil {
+		receipt.ContractAddress = *r.ContractAddress
+		// Nodes return lowercase addresses
+		if address, err := hex.DecodeString(strings.TrimPrefix(*r.ContractAddress, "0x")); err == nil && len(address) == 20 {
+			receipt.ContractAddress = checksumAddress(address)
+		}
+	}
+	if r.EffectiveGasPrice != nil {
+		receipt.EffectiveGasPrice, _ = parseAmount(*r.EffectiveGasPrice)
+	}
+	return receipt, nil
+}
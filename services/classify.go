@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"deploychain/models"
+)
+
+// Reasons a compiled contract is not deployed
+const (
+	skipNoBytecode = "interface or abstract contract (no bytecode)"
+	skipLibrary    = "library"
+	skipLinking    = "requires library linking"
+	skipDependency = "imported from a dependency"
+	skipTest       = "test contract"
+	skipScript     = "deployment script"
+	skipMock       = "mock contract"
+	skipNotListed  = "not listed in the manifest"
+)
+
+// libraryRuntimePrefix starts the runtime code of every library: PUSH20 of the
+// library's own address, zeroed at compile time, followed by the call guard
+const libraryRuntimePrefix = "0x73" + "0000000000000000000000000000000000000000" + "3014"
+
+// undeployableReason returns why a contract cannot be deployed on its own, or ""
+func undeployableReason(contract *models.CompiledContract) string {
+	bytecode := strings.TrimPrefix(contract.Bytecode, "0x")
+	switch {
+	case bytecode == "":
+		return skipNoBytecode
+	case strings.HasPrefix(strings.ToLower(contract.DeployedBytecode), libraryRuntimePrefix):
+		return skipLibrary
+	case contract.NeedsLinking || strings.Contains(bytecode, "__"):
+		return skipLinking
+	}
+	return ""
+}
+
+// classifyContract returns why a contract is left out of the inferred deployment, or "" if it is deployable
+func classifyContract(contract *models.CompiledContract) string {
+	if reason := undeployableReason(contract); reason != "" {
+		return reason
+	}
+
+	source := contract.SourcePath
+	if isDependencySource(source) {
+		return skipDependency
+	}
+	if strings.HasSuffix(source, ".t.sol") {
+		return skipTest
+	}
+	if strings.HasSuffix(source, ".s.sol") {
+		return skipScript
+	}
+	for _, dir := range strings.Split(path.Dir(source), "/") {
+		switch strings.ToLower(dir) {
+		case "test", "tests":
+			return skipTest
+		case "script", "scripts":
+			return skipScript
+		case "mock", "mocks":
+			return skipMock
+		}
+	}
+	if strings.HasPrefix(contract.Name, "Mock") || strings.HasSuffix(contract.Name, "Mock") {
+		return skipMock
+	}
+	return ""
+}
+
+// isDependencySource reports whether a source file comes from an installed package
+// rather than the project, e.g. @openzeppelin/... or Foundry's lib/forge-std/...
+func isDependencySource(source string) bool {
+	return strings.HasPrefix(source, "@") ||
+		strings.HasPrefix(source, "lib/") ||
+		strings.HasPrefix(source, "hardhat/") ||
+		strings.HasPrefix(source, "node_modules/") ||
+		strings.Contains(source, "/node_modules/")
+}
+
+// errDuplicateContract is returned when two of the project's own sources
+// declare a contract with the same name
+var errDuplicateContract = errors.New("duplicate contract name")
+
+// addCompiledContract records a contract, keeping the project's own contract when
+// an imported package declares one with the same name. Contracts are deployed by
+// name, so two project sources declaring the same name is an error.
+func addCompiledContract(contracts map[string]*models.CompiledContract, contract *models.CompiledContract) error {
+	existing, ok := contracts[contract.Name]
+	if !ok || isDependencySource(existing.SourcePath) && !isDependencySource(contract.SourcePath) {
+		contracts[contract.Name] = contract
+		return nil
+	}
+	if existing.SourcePath == contract.SourcePath || isDependencySource(contract.SourcePath) {
+		// Another compiler version of the same source, or a package's copy
+		return nil
+	}
+	return fmt.Errorf("%w: %s is declared in both %s and %s, rename one of them",
+		errDuplicateContract, contract.Name, existing.SourcePath, contract.SourcePath)
+}
+
+// selectDeployable infers the top-level contracts of a project. On top of the
+// classification, it leaves out contracts created by another contract's
+// constructor and helpers declared next to the main contract of a file.
+func selectDeployable(compiled map[string]*models.CompiledContract) (map[string]*models.CompiledContract, models.SkippedContractMap) {
+	candidates := make(map[string]*models.CompiledContract)
+	skipped := make(models.SkippedContractMap)
+	for name, contract := range compiled {
+		if reason := classifyContract(contract); reason != "" {
+			skipped[name] = reason
+		} else {
+			candidates[name] = contract
+		}
+	}
+
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// `new Child()` embeds Child's creation code in the parent's bytecode
+	for _, name := range names {
+		code := strings.TrimPrefix(candidates[name].Bytecode, "0x")
+		for _, other := range names {
+			if other != name && strings.Contains(candidates[other].Bytecode, code) {
+				skipped[name] = "created by " + other
+				break
+			}
+		}
+	}
+
+	// A file named after one of its contracts declares helpers alongside it
+	mainContract := make(map[string]bool)
+	for _, name := range names {
+		contract := candidates[name]
+		if strings.TrimSuffix(path.Base(contract.SourcePath), ".sol") == name {
+			mainContract[contract.SourcePath] = true
+		}
+	}
+	for _, name := range names {
+		contract := candidates[name]
+		if _, ok := skipped[name]; ok {
+			continue
+		}
+		base := strings.TrimSuffix(path.Base(contract.SourcePath), ".sol")
+		if mainContract[contract.SourcePath] && base != name {
+			skipped[name] = "not the main contract of " + contract.SourcePath
+		}
+	}
+
+	deployable := make(map[string]*models.CompiledContract)
+	for _, name := range names {
+		if _, ok := skipped[name]; !ok {
+			deployable[name] = candidates[name]
+		}
+	}
+	return deployable, skipped
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"deploychain/models"
+)
+
+func TestAddCompiledContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		// want is the source kept, empty when adding the second one fails
+		want string
+	}{
+		{"project contract over a package's", []string{"@openzeppelin/contracts/token/ERC20/ERC20.sol", "contracts/ERC20.sol"}, "contracts/ERC20.sol"},
+		{"package contract after the project's", []string{"contracts/ERC20.sol", "lib/solmate/src/tokens/ERC20.sol"}, "contracts/ERC20.sol"},
+		{"two packages", []string{"@openzeppelin/contracts/token/ERC20/ERC20.sol", "lib/solmate/src/tokens/ERC20.sol"}, "@openzeppelin/contracts/token/ERC20/ERC20.sol"},
+		{"two compiler versions", []string{"src/ERC20.sol", "src/ERC20.sol"}, "src/ERC20.sol"},
+		{"two project sources", []string{"contracts/ERC20.sol", "contracts/v2/ERC20.sol"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contracts := make(map[string]*models.CompiledContract)
+			if err := addCompiledContract(contracts, &models.CompiledContract{Name: "ERC20", SourcePath: test.sources[0]}); err != nil {
+				t.Fatal(err)
+			}
+			err := addCompiledContract(contracts, &models.CompiledContract{Name: "ERC20", SourcePath: test.sources[1]})
+			if test.want == "" {
+				if !errors.Is(err, errDuplicateContract) {
+					t.Fatalf("err = %v, want a duplicate contract error", err)
+				}
+				if got := contracts["ERC20"].SourcePath; got != test.sources[0] {
+					t.Errorf("kept %s after the error, want %s", got, test.sources[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contracts["ERC20"].SourcePath; got != test.want {
+				t.Errorf("kept %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deploychain/models"
+)
+
+// ConfirmationTracker waits for deployment transactions to be buried under enough blocks
+type ConfirmationTracker struct {
+	pollInterval time.Duration
+	timeout      time.Duration
+	// dropTimeout is how long a transaction may go without a receipt before it
+	// is considered dropped
+	dropTimeout time.Duration
+}
+
+// NewConfirmationTracker creates a tracker configured from the environment
+func NewConfirmationTracker() *ConfirmationTracker {
+	return &ConfirmationTracker{
+		pollInterval: receiptPollInterval,
+		timeout:      time.Duration(envInt("CONFIRMATION_TIMEOUT_SECONDS", 1800)) * time.Second,
+		dropTimeout:  receiptTimeout(),
+	}
+}
+
+// trackedTx is the last known state of a tracked transaction
+type trackedTx struct {
+	hash          string
+	blockHash     string
+	blockNumber   int64
+	confirmations int64
+	missingSince  time.Time
+}
+
+// WaitForConfirmations polls the receipts of txHashes until every transaction
+// has the required number of confirmations. It fails when a transaction reverts
+// or is dropped. onStatus is called with StatusConfirming while all transactions
+// are mined but not yet deep enough, and with StatusSubmitted whenever a reorg
+// removes a receipt, so the deployment status can follow.
+func (t *ConfirmationTracker) WaitForConfirmations(ctx context.Context, backend ChainBackend, txHashes []string, required int, logger *BuildLogger, onStatus func(status string)) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	tracked := make([]*trackedTx, len(txHashes))
+	for i, hash := range txHashes {
+		tracked[i] = &trackedTx{hash: hash, missingSince: time.Now()}
+	}
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	status := ""
+	for {
+		done, newStatus, err := t.poll(ctx, backend, tracked, int64(required), logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("waiting for %d confirmations: %w", required, ctx.Err())
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+		if newStatus != status {
+			status = newStatus
+			onStatus(status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %d confirmations: %w", required, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll refreshes every tracked transaction once. It reports whether all are
+// confirmed, and otherwise the status the deployment is in.
+func (t *ConfirmationTracker) poll(ctx context.Context, backend ChainBackend, tracked []*trackedTx, required int64, logger *BuildLogger) (bool, string, error) {
+	status, err := backend.Status(ctx)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get latest block: %v", err)
+	}
+	head := status.BlockNumber
+
+	confirmed, mined := 0, 0
+	for _, tx := range tracked {
+		receipt, err := backend.GetTransactionReceipt(ctx, tx.hash)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to get receipt of %s: %v", tx.hash, err)
+		}
+
+		if receipt == nil {
+			if tx.blockHash != "" {
+				logger.Warn(models.StageConfirm, "Transaction %s was removed from block %d by a reorg", tx.hash, tx.blockNumber)
+				tx.blockHash, tx.blockNumber, tx.confirmations = "", 0, 0
+				tx.missingSince = time.Now()
+			}
+			if time.Since(tx.missingSince) > t.dropTimeout {
+				return false, "", fmt.Errorf("transaction %s was dropped: no receipt for %s", tx.hash, t.dropTimeout)
+			}
+			continue
+		}
+
+		if tx.blockHash != "" && receipt.BlockHash != tx.blockHash {
+			logger.Warn(models.StageConfirm, "Transaction %s moved from block %d to block %d after a reorg", tx.hash, tx.blockNumber, receipt.BlockNumber)
+		}
+		if receipt.Status != 1 {
+			return false, "", fmt.Errorf("transaction %s reverted in block %d", tx.hash, receipt.BlockNumber)
+		}
+		tx.blockHash = receipt.BlockHash
+		tx.blockNumber = receipt.BlockNumber
+
+		confirmations := head - receipt.BlockNumber + 1
+		if confirmations < 1 {
+			// The node serving the receipt is ahead of the one reporting the head
+			confirmations = 1
+		}
+		if confirmations != tx.confirmations {
+			if confirmations < tx.confirmations {
+				logger.Warn(models.StageConfirm, "Transaction %s dropped to %d/%d confirmations", tx.hash, confirmations, required)
+			} else if confirmations >= required && tx.confirmations < required {
+				logger.Info(models.StageConfirm, "Transaction %s confirmed in block %d", tx.hash, receipt.BlockNumber)
+			}
+			tx.confirmations = confirmations
+		}
+
+		mined++
+		if confirmations >= required {
+			confirmed++
+		}
+	}
+
+	switch {
+	case confirmed == len(tracked):
+		return true, models.StatusDeployed, nil
+	case mined == len(tracked):
+		return false, models.StatusConfirming, nil
+	default:
+		return false, models.StatusSubmitted, nil
+	}
+}
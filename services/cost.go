@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"deploychain/models"
+)
+
+// etherDecimals is the number of decimals of ether and most native currencies
+const etherDecimals = 18
+
+// parseAmount parses a decimal or 0x-prefixed hex amount as reported by MultiBaas
+func parseAmount(s string) (*big.Int, bool) {
+	if s == "" {
+		return nil, false
+	}
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok || n.Sign() < 0 {
+		return nil, false
+	}
+	return n, true
+}
+
+// FormatEther formats an amount of wei as a decimal amount of ether,
+// e.g. "1500000000000000" as "0.0015". Invalid amounts are formatted as "0".
+func FormatEther(wei string) string {
+	return FormatUnits(wei, etherDecimals)
+}
+
+// FormatUnits formats an integer amount of the smallest unit of a currency with
+// the given number of decimals
+func FormatUnits(amount string, decimals int) string {
+	n, ok := parseAmount(amount)
+	if !ok {
+		return "0"
+	}
+	digits := n.String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-decimals]
+	fraction := strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// receiptCost returns the price paid per gas by a mined transaction and the
+// resulting cost in wei. The effective gas price of the receipt is preferred,
+// since under EIP-1559 it differs from the price the transaction offered.
+func receiptCost(receipt *Receipt, offeredGasPrice *big.Int) (*big.Int, *big.Int, error) {
+	price := receipt.EffectiveGasPrice
+	if price == nil {
+		price = offeredGasPrice
+	}
+	if price == nil {
+		return nil, nil, fmt.Errorf("no gas price for transaction %s", receipt.TxHash)
+	}
+	return price, new(big.Int).Mul(big.NewInt(receipt.GasUsed), price), nil
+}
+
+// summarizeContracts returns the addresses of the deployed contracts and the
+// hashes of all transactions sent, reverted ones included
+func summarizeContracts(contracts []models.ContractDeployment) (models.ContractAddressMap, []string) {
+	addresses := make(models.ContractAddressMap)
+	var txHashes []string
+	for _, contract := range contracts {
+		if contract.Status == models.ContractStatusDeployed {
+			addresses[contract.Name] = contract.Address
+		}
+		txHashes = append(txHashes, contract.TransactionHash)
+	}
+	return addresses, txHashes
+}
@@ -4,91 +4,186 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"regexp"
 	"strings"
-	"time"
 
 	"deploychain/models"
 
 	"dagger.io/dagger"
 )
 
+// Default container images, deploychain.yaml can override them per build step
+const (
+	nodeImage    = "node:18-alpine"
+	foundryImage = "ghcr.io/foundry-rs/foundry:latest"
+)
+
 // DaggerService handles build and deployment pipelines
 type DaggerService struct {
-	client *dagger.Client
+	client    *dagger.Client
+	sites     *SiteStore
+	networks  *NetworkRegistry
+	artifacts *ArtifactStore
 }
 
 // NewDaggerService initializes a new Dagger client
-func NewDaggerService() *DaggerService {
+func NewDaggerService(sites *SiteStore, networks *NetworkRegistry, artifacts *ArtifactStore) *DaggerService {
 	client, err := dagger.Connect(context.Background(), dagger.WithLogOutput(os.Stdout))
 	if err != nil {
 		log.Fatalf("Failed to initialize Dagger client: %v", err)
 	}
-	return &DaggerService{client: client}
+	return &DaggerService{client: client, sites: sites, networks: networks, artifacts: artifacts}
 }
 
-// RunPipeline executes the build and deployment pipeline
-func (ds *DaggerService) RunPipeline(repoURL, branch string, deploymentID int) (models.BuildResult, error) {
-	ctx := context.Background()
+// RunPipeline executes the build and deployment pipeline, recording each stage in logger
+// Cancelling ctx aborts the running Dagger operations. The frontend is only
+// built and published with buildFrontend.
+func (ds *DaggerService) RunPipeline(ctx context.Context, repoURL, branch string, deploymentID int, buildFrontend bool, logger *BuildLogger) (models.BuildResult, error) {
 	result := models.BuildResult{
 		DeploymentType: models.TypeDApp,
 	}
 
 	// Clone repository
+	logger.StartStage(models.StageClone)
+	logger.Info(models.StageClone, "Cloning %s (branch %s)", repoURL, branch)
 	repo := ds.client.Git(repoURL).Branch(branch).Tree()
+	logger.EndStage(models.StageClone, nil)
 
-	// Detect project type
-	isWeb3, err := ds.detectWeb3Project(ctx, repo)
+	// Read the project manifest, if any
+	logger.StartStage(models.StageDetect)
+	manifest, manifestFile, err := loadManifest(ctx, repo, ds.networks)
 	if err != nil {
-		return result, fmt.Errorf("failed to detect project type: %v", err)
+		var manifestErr *ManifestError
+		if errors.As(err, &manifestErr) {
+			for _, problem := range manifestErr.Problems {
+				logger.Error(models.StageDetect, "%s: %s", manifestErr.File, problem)
+			}
+		} else {
+			logger.Error(models.StageDetect, "Failed to read %s: %v", manifestFile, err)
+		}
+		logger.EndStage(models.StageDetect, err)
+		return result, err
 	}
-	if !isWeb3 {
-		return result, fmt.Errorf("not a Web3 project")
+	if manifest != nil {
+		logger.Info(models.StageDetect, "Using %s (type %s, networks %s)",
+			manifestFile, manifest.Type, strings.Join(manifest.Networks, ", "))
+		result.Manifest = manifest
+		result.DeploymentType = manifest.Type
 	}
 
-	// Build smart contracts
-	contracts, err := ds.compileContracts(ctx, repo)
+	// Detect project type and workspace layout
+	layout, err := ds.detectLayout(ctx, repo)
+	if err == nil && manifest != nil {
+		err = ds.applyManifest(ctx, repo, layout, manifest)
+	}
 	if err != nil {
-		return result, fmt.Errorf("contract compilation failed: %v", err)
+		logger.Error(models.StageDetect, "Failed to detect project type: %v", err)
+		logger.EndStage(models.StageDetect, err)
+		return result, fmt.Errorf("failed to detect project type: %v", err)
+	}
+	if result.DeploymentType == models.TypeStatic {
+		if layout.FrontendPath == "" {
+			err := fmt.Errorf("no frontend found")
+			logger.Error(models.StageDetect, "Static deployment has no frontend to build")
+			logger.EndStage(models.StageDetect, err)
+			return result, err
+		}
+	} else if layout.Framework == "" {
+		err := fmt.Errorf("not a Web3 project")
+		logger.Error(models.StageDetect, "No Hardhat or Foundry project found")
+		logger.EndStage(models.StageDetect, err)
+		return result, err
+	}
+	layout.Repository = repoURL
+	recordLayout(&result, layout)
+	if layout.Framework != "" {
+		logger.Info(models.StageDetect, "Detected %s project in %s (package manager: %s)",
+			layout.Framework, layout.ContractsPath, layout.PackageManager)
+	}
+	if layout.FrontendPath != "" {
+		logger.Info(models.StageDetect, "Detected frontend in %s", layout.FrontendPath)
+	}
+	if layout.Workspaces {
+		logger.Info(models.StageDetect, "Installing from the workspace root, packages: %s", strings.Join(layout.Packages, ", "))
 	}
-	result.CompiledContracts = contracts
+	logger.EndStage(models.StageDetect, nil)
 
-	// // Build frontend
-	// frontendURL, err := ds.buildFrontend(ctx, repo)
-	// if err != nil {
-	// 	return result, fmt.Errorf("frontend build failed: %v", err)
-	// }
-	// result.FrontendURL = frontendURL
+	// Build smart contracts, static deployments have none
+	if layout.Framework != "" {
+		logger.StartStage(models.StageCompile)
+		contracts, err := ds.compileContracts(ctx, repo, layout, deploymentID, logger)
+		if err != nil {
+			logger.Error(models.StageCompile, "Contract compilation failed: %v", err)
+			logger.EndStage(models.StageCompile, err)
+			return result, fmt.Errorf("contract compilation failed: %v", err)
+		}
+		result.CompiledContracts = contracts
+		logger.Info(models.StageCompile, "Compiled %d contract artifacts", len(contracts))
+		logger.EndStage(models.StageCompile, nil)
+	}
 
-	// Log build steps
-	result.BuildLogs = append(result.BuildLogs,
-		"Cloned repository",
-		"Detected Web3 project",
-		"Compiled smart contracts",
-		"Built frontend dApp",
-	)
+	// Build frontend when the repository has one
+	if layout.FrontendPath != "" && buildFrontend {
+		logger.StartStage(models.StageFrontend)
+		frontendURL, err := ds.buildFrontend(ctx, repo, layout, deploymentID, logger)
+		if err != nil {
+			logger.Error(models.StageFrontend, "Frontend build failed: %v", err)
+			logger.EndStage(models.StageFrontend, err)
+			return result, fmt.Errorf("frontend build failed: %v", err)
+		}
+		result.FrontendURL = frontendURL
+		logger.Info(models.StageFrontend, "Frontend published at %s", frontendURL)
+		logger.EndStage(models.StageFrontend, nil)
+	}
 
 	return result, nil
 }
 
-// detectWeb3Project checks if the repository contains a Web3 project
-func (ds *DaggerService) detectWeb3Project(ctx context.Context, repo *dagger.Directory) (bool, error) {
-	hasContracts, err := repo.Directory("contracts").Entries(ctx)
+// detectWeb3Project checks if the repository contains a Web3 project and
+// returns the framework used to build it, or "" if none was found
+func (ds *DaggerService) detectWeb3Project(ctx context.Context, repo *dagger.Directory) (string, error) {
+	entries, err := repo.Entries(ctx)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	// Check if hardhat config exists
-	_, err = repo.File("hardhat.config.js").Contents(ctx)
-	if err != nil {
-		// File doesn't exist or can't be read, only check contracts
-		return len(hasContracts) > 0, nil
+	hasContracts := false
+	hasHardhatConfig := false
+	for _, entry := range entries {
+		switch strings.TrimSuffix(entry, "/") {
+		case "foundry.toml":
+			// Foundry takes precedence, hybrid repos build with forge
+			return models.FrameworkFoundry, nil
+		case "hardhat.config.js", "hardhat.config.ts", "hardhat.config.cjs", "hardhat.config.mjs":
+			hasHardhatConfig = true
+		case "contracts":
+			hasContracts = true
+		}
 	}
 
 	// Either has contracts or hardhat config
-	return true, nil
+	if hasHardhatConfig || hasContracts {
+		return models.FrameworkHardhat, nil
+	}
+	return "", nil
+}
+
+// compileContracts compiles Solidity contracts with the detected framework and
+// keeps the compiler output as artifacts of the deployment
+func (ds *DaggerService) compileContracts(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, deploymentID int, logger *BuildLogger) (map[string]*models.CompiledContract, error) {
+	switch layout.Framework {
+	case models.FrameworkFoundry:
+		return ds.compileFoundryContracts(ctx, repo, layout, deploymentID, logger)
+	case models.FrameworkHardhat:
+		return ds.compileHardhatContracts(ctx, repo, layout, deploymentID, logger)
+	default:
+		return nil, fmt.Errorf("unsupported framework: %s", layout.Framework)
+	}
 }
 
 // // compileContracts compiles Solidity contracts
@@ -139,115 +234,345 @@ func (ds *DaggerService) detectWeb3Project(ctx context.Context, repo *dagger.Dir
 // 	return contracts, nil
 // }
 
-// compileContracts compiles Solidity contracts and exports to filesystem
-func (ds *DaggerService) compileContracts(ctx context.Context, repo *dagger.Directory) (map[string]*models.CompiledContract, error) {
+// compileHardhatContracts compiles Solidity contracts with Hardhat and stores the artifacts
+func (ds *DaggerService) compileHardhatContracts(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, deploymentID int, logger *BuildLogger) (map[string]*models.CompiledContract, error) {
 	contracts := make(map[string]*models.CompiledContract)
+	packageDir := containerPath("/app", layout.ContractsPath)
 
-	// Use Hardhat container to compile contracts
-	container := ds.client.Container().
-		From("node:18-alpine").
+	// Use Hardhat container to compile contracts. Workspaces install from the
+	// root so hoisted dependencies resolve, then compile in the contract package.
+	caches := ds.nodeCaches(ctx, repo, layout, "/app", layout.ContractsPath, logger, models.StageCompile)
+	caches.add("hardhat compilers", "hardhat-compilers", hardhatCompilersPath)
+	container := layout.buildContainer(ds.client, nodeImage, layout.Contracts).
 		WithMountedDirectory("/app", repo).
-		WithWorkdir("/app").
-		WithExec([]string{"npm", "install"}).
-		WithExec([]string{"npx", "hardhat", "compile"})
+		WithWorkdir(containerPath("/app", layout.InstallDir(layout.ContractsPath)))
+	container = caches.mount(ds.client, container)
+
+	container, err := installDependencies(ctx, logger, models.StageCompile, container, layout, layout.Contracts, caches)
+	if err != nil {
+		return nil, fmt.Errorf("dependency installation failed: %v", err)
+	}
+	container, err = caches.run(ctx, logger, models.StageCompile, container.WithWorkdir(packageDir),
+		buildCommandFor(layout.Contracts, []string{"npx", "hardhat", "compile"}), false)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get the artifacts directory from the container
-	artifactsDir := container.Directory("/app/artifacts")
+	artifactsDir := container.Directory(containerPath(packageDir, "artifacts"))
 
-	// Export the artifacts to local filesystem
-	localArtifactsPath := "./build/artifacts" // Local path where you want to save
-	_, err := artifactsDir.Export(ctx, localArtifactsPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to export artifacts to filesystem: %w", err)
+	// Keep the artifacts, build-info included, apart from other deployments
+	if err := ds.storeArtifacts(ctx, artifactsDir, deploymentID, models.ArtifactsContracts); err != nil {
+		return nil, err
 	}
 
-	entries, err := artifactsDir.Entries(ctx)
-	if err != nil {
+	// Hardhat structure: artifacts/<source path>/<Contract>.json, covering the
+	// project's contracts as well as imported packages such as @openzeppelin
+	if err := ds.collectHardhatArtifacts(ctx, artifactsDir, "", contracts, logger); err != nil {
 		return nil, err
 	}
+	if len(contracts) == 0 {
+		return nil, fmt.Errorf("no contract artifacts found")
+	}
+	// The standard-JSON inputs in build-info are what explorers verify sources from
+	if err := ds.attachHardhatBuildInfo(ctx, artifactsDir.Directory("build-info"), contracts); err != nil {
+		logger.Warn(models.StageCompile, "Contract sources cannot be verified without build-info: %v", err)
+	}
+
+	return contracts, nil
+}
 
-	fmt.Printf("Artifacts exported to: %s\n", localArtifactsPath)
+// hardhatBuildInfo is the part of a Hardhat build-info file identifying the
+// compiler input of the contracts it compiled
+type hardhatBuildInfo struct {
+	SolcLongVersion string          `json:"solcLongVersion"`
+	Input           json.RawMessage `json:"input"`
+	Output          struct {
+		Contracts map[string]map[string]json.RawMessage `json:"contracts"`
+	} `json:"output"`
+}
+
+// solcSettings are the settings of a standard-JSON input or contract metadata
+// recorded with a contract
+type solcSettings struct {
+	Optimizer struct {
+		Enabled bool `json:"enabled"`
+		Runs    int  `json:"runs"`
+	} `json:"optimizer"`
+	EVMVersion string `json:"evmVersion"`
+	ViaIR      bool   `json:"viaIR"`
+}
+
+// apply records the settings on a contract
+func (s solcSettings) apply(contract *models.CompiledContract) {
+	contract.OptimizerEnabled = s.Optimizer.Enabled
+	contract.OptimizerRuns = s.Optimizer.Runs
+	contract.EVMVersion = s.EVMVersion
+	contract.ViaIR = s.ViaIR
+}
 
-	// Process compiled contracts - Hardhat structure: artifacts/contracts/
-	if len(entries) == 0 {
-		return nil, fmt.Errorf("no entries found in artifacts directory")
+// spdxPattern matches the license comment of a Solidity source file
+var spdxPattern = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*]+)`)
+
+// sourceLicense returns the SPDX license identifier of a source file, "" without one
+func sourceLicense(content string) string {
+	if m := spdxPattern.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// attachHardhatBuildInfo sets the standard-JSON input, full compiler version,
+// settings and license of every contract found in the build-info files of a
+// compilation. Each build-info file holds one solc run, the .dbg.json next to
+// an artifact naming the one it came from.
+func (ds *DaggerService) attachHardhatBuildInfo(ctx context.Context, dir *dagger.Directory, contracts map[string]*models.CompiledContract) error {
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return err
+	}
+
+	bySource := make(map[string]*models.CompiledContract, len(contracts))
+	for _, contract := range contracts {
+		bySource[contract.SourcePath+":"+contract.Name] = contract
 	}
 
-	// Look for the contracts subdirectory
-	var contractsDir *dagger.Directory
 	for _, entry := range entries {
-		fmt.Printf("Checking entry: '%s'\n", entry)
-		if strings.TrimSuffix(entry, "/") == "contracts" {
-			contractsDir = artifactsDir.Directory("contracts")
-			fmt.Printf("Found contracts directory!\n")
-			break
+		if !strings.HasSuffix(entry, ".json") {
+			continue
+		}
+		contents, err := dir.File(entry).Contents(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", entry, err)
+		}
+		var info hardhatBuildInfo
+		if err := json.Unmarshal([]byte(contents), &info); err != nil {
+			return fmt.Errorf("invalid build-info %s: %v", entry, err)
+		}
+
+		var input struct {
+			Sources map[string]struct {
+				Content string `json:"content"`
+			} `json:"sources"`
+			Settings solcSettings `json:"settings"`
+		}
+		if err := json.Unmarshal(info.Input, &input); err != nil {
+			return fmt.Errorf("invalid compiler input in %s: %v", entry, err)
+		}
+
+		standardJSON := string(info.Input)
+		for source, names := range info.Output.Contracts {
+			for name := range names {
+				contract, ok := bySource[source+":"+name]
+				if !ok {
+					continue
+				}
+				contract.SourceCode = standardJSON
+				contract.CompilerVersion = info.SolcLongVersion
+				input.Settings.apply(contract)
+				contract.License = sourceLicense(input.Sources[source].Content)
+			}
 		}
 	}
+	return nil
+}
 
-	if contractsDir == nil {
-		return nil, fmt.Errorf("contracts directory not found in artifacts")
+// collectHardhatArtifacts walks a Hardhat artifacts directory and parses the
+// artifacts of every <File>.sol directory below it. Artifacts that cannot be
+// read are skipped with a warning in the build log.
+func (ds *DaggerService) collectHardhatArtifacts(ctx context.Context, dir *dagger.Directory, dirPath string, contracts map[string]*models.CompiledContract, logger *BuildLogger) error {
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Get contract source directories (e.g., MyContract.sol/)
-	contractDirs, err := contractsDir.Entries(ctx)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry, "/")
+		switch {
+		case dirPath == "" && name == "build-info":
+			continue
+		case strings.HasSuffix(name, ".json"):
+			continue
+		case !strings.HasSuffix(name, ".sol"):
+			if err := ds.collectHardhatArtifacts(ctx, dir.Directory(name), path.Join(dirPath, name), contracts, logger); err != nil {
+				if errors.Is(err, errDuplicateContract) {
+					return err
+				}
+				logger.Warn(models.StageCompile, "Skipping artifacts in artifacts/%s: %v", path.Join(dirPath, name), err)
+			}
+			continue
+		}
+
+		// Navigate to specific contract directory (e.g., contracts/MyContract.sol/)
+		specificContractDir := dir.Directory(name)
+		contractFiles, err := specificContractDir.Entries(ctx)
+		if err != nil {
+			logger.Warn(models.StageCompile, "Skipping artifacts in artifacts/%s: %v", path.Join(dirPath, name), err)
+			continue
+		}
+
+		for _, contractFile := range contractFiles {
+			if !strings.HasSuffix(contractFile, ".json") || strings.HasSuffix(contractFile, ".dbg.json") {
+				continue
+			}
+			contractName := strings.TrimSuffix(contractFile, ".json")
+
+			// Read the JSON artifact
+			artifact, err := specificContractDir.File(contractFile).Contents(ctx)
+			if err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact artifacts/%s: %v", path.Join(dirPath, name, contractFile), err)
+				continue
+			}
+
+			var compiled struct {
+				SourceName       string                     `json:"sourceName"`
+				Bytecode         string                     `json:"bytecode"`
+				DeployedBytecode string                     `json:"deployedBytecode"`
+				ABI              interface{}                `json:"abi"`
+				LinkReferences   map[string]json.RawMessage `json:"linkReferences"`
+			}
+			if err := json.Unmarshal([]byte(artifact), &compiled); err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact artifacts/%s: invalid JSON: %v", path.Join(dirPath, name, contractFile), err)
+				continue
+			}
+
+			// Convert ABI to string
+			abiBytes, err := json.Marshal(compiled.ABI)
+			if err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact artifacts/%s: invalid ABI: %v", path.Join(dirPath, name, contractFile), err)
+				continue
+			}
+
+			sourcePath := compiled.SourceName
+			if sourcePath == "" {
+				sourcePath = path.Join(dirPath, name)
+			}
+			if err := addCompiledContract(contracts, &models.CompiledContract{
+				Name:             contractName,
+				Bytecode:         compiled.Bytecode,
+				ABI:              string(abiBytes),
+				SourcePath:       sourcePath,
+				DeployedBytecode: compiled.DeployedBytecode,
+				NeedsLinking:     len(compiled.LinkReferences) > 0,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileFoundryContracts compiles Solidity contracts with forge and parses the out/ directory
+func (ds *DaggerService) compileFoundryContracts(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, deploymentID int, logger *BuildLogger) (map[string]*models.CompiledContract, error) {
+	contracts := make(map[string]*models.CompiledContract)
+	packageDir := containerPath("/app", layout.ContractsPath)
+
+	// Use Foundry container to compile contracts. The image runs as an
+	// unprivileged user by default, which cannot write out/ in the mount.
+	// HOME follows the user, so the solc releases forge installs land in the svm cache.
+	caches := newStepCaches(layout.Repository)
+	caches.add("svm", "svm", svmPath)
+	caches.env["HOME"] = "/root"
+	container := layout.buildContainer(ds.client, foundryImage, layout.Contracts).
+		WithUser("root").
+		WithMountedDirectory("/app", repo).
+		WithWorkdir(packageDir)
+	container = caches.mount(ds.client, container)
+
+	// forge needs no install step, but a manifest may ask for one (e.g. forge install)
+	var err error
+	if layout.Contracts.Install != "" {
+		container, err = caches.run(ctx, logger, models.StageCompile, container, layout.installCommandFor(layout.Contracts), false)
+		if err != nil {
+			return nil, fmt.Errorf("dependency installation failed: %v", err)
+		}
+	}
+	container, err = caches.run(ctx, logger, models.StageCompile, container, buildCommandFor(layout.Contracts, []string{"forge", "build"}), false)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("Contract directories found: %v\n", contractDirs)
+	// Foundry structure: out/<File>.sol/<Contract>.json
+	outDir := container.Directory(containerPath(packageDir, "out"))
+	contractDirs, err := outDir.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contractDirs) == 0 {
+		return nil, fmt.Errorf("no entries found in out directory")
+	}
+	if err := ds.storeArtifacts(ctx, outDir, deploymentID, models.ArtifactsContracts); err != nil {
+		return nil, err
+	}
 
 	for _, contractDirName := range contractDirs {
+		contractDirName = strings.TrimSuffix(contractDirName, "/")
 		if !strings.HasSuffix(contractDirName, ".sol") {
 			continue
 		}
 
-		// Navigate to specific contract directory (e.g., contracts/MyContract.sol/)
-		specificContractDir := contractsDir.Directory(contractDirName)
+		specificContractDir := outDir.Directory(contractDirName)
 		contractFiles, err := specificContractDir.Entries(ctx)
 		if err != nil {
-			fmt.Printf("Error reading contract directory %s: %v\n", contractDirName, err)
+			logger.Warn(models.StageCompile, "Skipping artifacts in out/%s: %v", contractDirName, err)
 			continue
 		}
 
-		fmt.Printf("Files in %s: %v\n", contractDirName, contractFiles)
-
 		for _, contractFile := range contractFiles {
-			if strings.HasSuffix(contractFile, ".json") && !strings.HasSuffix(contractFile, ".dbg.json") {
-				contractName := strings.TrimSuffix(contractFile, ".json")
-
-				fmt.Printf("Processing contract file: %s -> %s\n", contractFile, contractName)
+			if !strings.HasSuffix(contractFile, ".json") {
+				continue
+			}
 
-				// Read the JSON artifact
-				artifact, err := specificContractDir.File(contractFile).Contents(ctx)
-				if err != nil {
-					fmt.Printf("Error reading artifact for %s: %v\n", contractName, err)
-					continue
-				}
+			// Multiple compiler versions produce <Contract>.<version>.json, keep the plain name
+			contractName := strings.TrimSuffix(contractFile, ".json")
+			if i := strings.Index(contractName, "."); i >= 0 {
+				contractName = contractName[:i]
+			}
 
-				var compiled struct {
-					Bytecode string      `json:"bytecode"`
-					ABI      interface{} `json:"abi"`
-				}
-				if err := json.Unmarshal([]byte(artifact), &compiled); err != nil {
-					fmt.Printf("Error unmarshaling artifact for %s: %v\n", contractName, err)
-					continue
-				}
+			artifact, err := specificContractDir.File(contractFile).Contents(ctx)
+			if err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact out/%s/%s: %v", contractDirName, contractFile, err)
+				continue
+			}
 
-				// Convert ABI to string
-				abiBytes, err := json.Marshal(compiled.ABI)
-				if err != nil {
-					fmt.Printf("Error marshaling ABI for %s: %v\n", contractName, err)
-					continue
-				}
+			// Unlike Hardhat, forge nests the creation code under bytecode.object
+			var compiled struct {
+				ABI      interface{} `json:"abi"`
+				Bytecode struct {
+					Object         string                     `json:"object"`
+					LinkReferences map[string]json.RawMessage `json:"linkReferences"`
+				} `json:"bytecode"`
+				DeployedBytecode struct {
+					Object string `json:"object"`
+				} `json:"deployedBytecode"`
+				Metadata json.RawMessage `json:"metadata"`
+			}
+			if err := json.Unmarshal([]byte(artifact), &compiled); err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact out/%s/%s: invalid JSON: %v", contractDirName, contractFile, err)
+				continue
+			}
 
-				contracts[contractName] = &models.CompiledContract{
-					Name:            contractName,
-					Bytecode:        compiled.Bytecode,
-					ABI:             string(abiBytes),
-					CompilerVersion: "0.8.19", // Updated to match the compiler version from logs
-				}
+			abiBytes, err := json.Marshal(compiled.ABI)
+			if err != nil {
+				logger.Warn(models.StageCompile, "Skipping artifact out/%s/%s: invalid ABI: %v", contractDirName, contractFile, err)
+				continue
+			}
 
-				fmt.Printf("✅ Processed contract: %s (bytecode length: %d)\n", contractName, len(compiled.Bytecode))
+			contract := &models.CompiledContract{
+				Name:             contractName,
+				Bytecode:         withHexPrefix(compiled.Bytecode.Object),
+				ABI:              string(abiBytes),
+				SourcePath:       foundrySourcePath(compiled.Metadata, contractDirName),
+				DeployedBytecode: withHexPrefix(compiled.DeployedBytecode.Object),
+				NeedsLinking:     len(compiled.Bytecode.LinkReferences) > 0,
+			}
+			if err := applyFoundryMetadata(contract, compiled.Metadata); err != nil {
+				logger.Warn(models.StageCompile, "No compiler metadata for %s: %v", contractName, err)
+			}
+			if err := addCompiledContract(contracts, contract); err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -255,6 +580,54 @@ func (ds *DaggerService) compileContracts(ctx context.Context, repo *dagger.Dire
 	return contracts, nil
 }
 
+// foundrySourcePath returns the source file of a forge artifact from its metadata,
+// falling back to the out/ directory name
+func foundrySourcePath(metadata json.RawMessage, contractDirName string) string {
+	var parsed struct {
+		Settings struct {
+			CompilationTarget map[string]string `json:"compilationTarget"`
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(metadata, &parsed); err == nil {
+		for source := range parsed.Settings.CompilationTarget {
+			return source
+		}
+	}
+	return contractDirName
+}
+
+// applyFoundryMetadata sets the compiler version, settings and license of a
+// contract from the solc metadata forge keeps in its artifact
+func applyFoundryMetadata(contract *models.CompiledContract, metadata json.RawMessage) error {
+	var parsed struct {
+		Compiler struct {
+			Version string `json:"version"`
+		} `json:"compiler"`
+		Settings solcSettings `json:"settings"`
+		Sources  map[string]struct {
+			License string `json:"license"`
+		} `json:"sources"`
+	}
+	if len(metadata) == 0 {
+		return fmt.Errorf("artifact has no metadata")
+	}
+	if err := json.Unmarshal(metadata, &parsed); err != nil {
+		return fmt.Errorf("invalid metadata: %v", err)
+	}
+	contract.CompilerVersion = parsed.Compiler.Version
+	parsed.Settings.apply(contract)
+	contract.License = parsed.Sources[contract.SourcePath].License
+	return nil
+}
+
+// withHexPrefix adds the 0x prefix forge leaves off bytecode
+func withHexPrefix(bytecode string) string {
+	if bytecode != "" && !strings.HasPrefix(bytecode, "0x") {
+		return "0x" + bytecode
+	}
+	return bytecode
+}
+
 // Alternative: Export specific files instead of entire directory
 func (ds *DaggerService) exportContractArtifacts(ctx context.Context, container *dagger.Container, outputPath string) error {
 	// Create output directory if it doesn't exist
@@ -273,41 +646,107 @@ func (ds *DaggerService) exportContractArtifacts(ctx context.Context, container
 	return nil
 }
 
-// buildFrontend builds the frontend and returns the deployment URL
-func (ds *DaggerService) buildFrontend(ctx context.Context, repo *dagger.Directory) (string, error) {
-	// Check for Next.js or static site
-	_, err := repo.File("next.config.js").Contents(ctx)
-	hasNextConfig := err == nil
+// frontendOutputDirs are checked in order for the built site
+var frontendOutputDirs = []string{"out", "dist", "build", "public"}
 
-	var output *dagger.Directory
-	if hasNextConfig {
-		// Build Next.js app
-		output = ds.client.Container().
-			From("node:18-alpine").
+// buildFrontend builds the frontend, stores the output in the site store and returns its URL
+func (ds *DaggerService) buildFrontend(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, deploymentID int, logger *BuildLogger) (string, error) {
+	if layout.FrontendPath == "" {
+		return "", fmt.Errorf("no frontend package found")
+	}
+	frontend := subdirectory(repo, layout.FrontendPath)
+	frontendDir := containerPath("/src", layout.FrontendPath)
+
+	hasBuildScript := layout.Frontend.Build != ""
+	buildCommand := layout.RunScriptCommand("build")
+	basePath := ds.sites.BasePath(deploymentID)
+	if pkg, err := readPackageJSON(ctx, frontend); err == nil && !hasBuildScript {
+		var script string
+		script, hasBuildScript = pkg.Scripts["build"]
+		// Vite takes the base path on its command line
+		if basePath != "" && strings.Contains(script, "vite build") {
+			buildCommand = layout.RunScriptCommand("build", "--base="+basePath+"/")
+		}
+	}
+
+	source := frontend
+	if hasBuildScript {
+		// Build Next.js, Vite or CRA app. NEXT_PUBLIC_IPFS_BUILD switches
+		// Scaffold-ETH 2 to a static export. PUBLIC_URL sets CRA's base path,
+		// Next.js apps read NEXT_PUBLIC_BASE_PATH into basePath and assetPrefix.
+		caches := ds.nodeCaches(ctx, repo, layout, "/src", layout.FrontendPath, logger, models.StageFrontend)
+		container := layout.buildContainer(ds.client, nodeImage, layout.Frontend).
 			WithMountedDirectory("/src", repo).
-			WithWorkdir("/src").
-			WithExec([]string{"npm", "install"}).
-			WithExec([]string{"npx", "run", "build"}).
-			Directory("/src/out")
-	} else {
-		// Try to find static site directory - first check public/
-		output = repo.Directory("public")
-
-		// Check if public directory has any entries
-		entries, err := output.Entries(ctx)
-		if err != nil || len(entries) == 0 {
-			// If public doesn't exist or is empty, try build/
-			output = repo.Directory("build")
-
-			// Optionally, you could also check if build/ exists and has content
-			buildEntries, buildErr := output.Entries(ctx)
-			if buildErr != nil || len(buildEntries) == 0 {
-				return "", fmt.Errorf("no static site directory found (tried public/ and build/)")
-			}
+			WithEnvVariable("NEXT_PUBLIC_IPFS_BUILD", "true").
+			WithEnvVariable("PUBLIC_URL", basePath).
+			WithEnvVariable("NEXT_PUBLIC_BASE_PATH", basePath).
+			WithWorkdir(containerPath("/src", layout.InstallDir(layout.FrontendPath)))
+		container = caches.mount(ds.client, container)
+
+		container, err := installDependencies(ctx, logger, models.StageFrontend, container, layout, layout.Frontend, caches)
+		if err != nil {
+			return "", fmt.Errorf("dependency installation failed: %v", err)
+		}
+		container, err = execStage(ctx, logger, models.StageFrontend, container.WithWorkdir(frontendDir),
+			buildCommandFor(layout.Frontend, buildCommand))
+		if err != nil {
+			return "", err
 		}
+		source = container.Directory(frontendDir)
+	}
+
+	// Pick the first output directory that contains an index.html
+	outputDirs := frontendOutputDirs
+	if layout.FrontendOutput != "" {
+		outputDirs = []string{layout.FrontendOutput}
+	}
+	var output *dagger.Directory
+	var index string
+	for _, dir := range outputDirs {
+		if contents, err := source.File(dir + "/index.html").Contents(ctx); err == nil {
+			output = source.Directory(dir)
+			index = contents
+			logger.Info(models.StageFrontend, "Using frontend output directory %s", dir)
+			break
+		}
+	}
+	if output == nil {
+		return "", fmt.Errorf("no static site output found (tried %s); Next.js apps need output: 'export'",
+			strings.Join(outputDirs, "/, ")+"/")
+	}
+
+	// A site built for the root of its host would load a blank page
+	if assets := rootAssets(index, basePath); len(assets) > 0 {
+		return "", fmt.Errorf("the site is served under %s/ but loads %s from the root of its host; "+
+			"build it for that base path (Vite --base, Next.js basePath and assetPrefix from NEXT_PUBLIC_BASE_PATH, CRA PUBLIC_URL) "+
+			"or serve sites on their own host with SITE_ROUTING=host", basePath, strings.Join(assets, ", "))
+	}
+
+	siteDir := ds.sites.Dir(deploymentID)
+	if _, err := output.Export(ctx, siteDir, dagger.DirectoryExportOpts{Wipe: true}); err != nil {
+		return "", fmt.Errorf("failed to export site: %w", err)
+	}
+
+	if err := ds.artifacts.AddDirectory(ctx, deploymentID, models.ArtifactsFrontend, siteDir); err != nil {
+		logger.Warn(models.StageFrontend, "Failed to store the frontend bundle: %v", err)
 	}
+	return ds.sites.URL(deploymentID), nil
+}
 
-	// Deploy to storage (e.g., S3, IPFS, etc.)
-	// For simplicity, return a mock URL
-	return fmt.Sprintf("https://app-%d.deploychain.locci.cloud", time.Now().Unix()), nil
+// storeArtifacts exports a directory of build outputs and stores its files as
+// artifacts of a deployment under prefix
+func (ds *DaggerService) storeArtifacts(ctx context.Context, dir *dagger.Directory, deploymentID int, prefix string) error {
+	tmp, err := os.MkdirTemp("", "deploychain-artifacts-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := dir.Export(ctx, tmp); err != nil {
+		return fmt.Errorf("failed to export artifacts: %w", err)
+	}
+	if err := ds.artifacts.AddDirectory(ctx, deploymentID, prefix, tmp); err != nil {
+		return fmt.Errorf("failed to store artifacts: %w", err)
+	}
+	return nil
 }
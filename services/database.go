@@ -4,6 +4,8 @@ package services
 import (
     "database/sql"
     "errors"
+    "fmt"
+    "strings"
     // "log"
     "os"
 
@@ -12,6 +14,12 @@ import (
     _ "github.com/lib/pq"
 )
 
+// ErrDeploymentCancelled is returned when updating a deployment that was cancelled
+var ErrDeploymentCancelled = errors.New("deployment was cancelled")
+
+// ErrDeploymentFinished is returned when cancelling a deployment that already finished
+var ErrDeploymentFinished = errors.New("deployment already finished")
+
 // Database wraps the database connection
 type Database struct {
     db *sql.DB
@@ -73,8 +81,191 @@ func createTables(db *sql.DB) error {
             level TEXT NOT NULL,
             timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
         );
+
+        ALTER TABLE deployments
+            ADD COLUMN IF NOT EXISTS contracts_path TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS frontend_path TEXT NOT NULL DEFAULT '';
+
+        CREATE TABLE IF NOT EXISTS jobs (
+            id SERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            kind TEXT NOT NULL,
+            payload JSONB NOT NULL,
+            status TEXT NOT NULL,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            max_attempts INTEGER NOT NULL DEFAULT 3,
+            lease_owner TEXT,
+            lease_expires_at TIMESTAMP WITH TIME ZONE,
+            heartbeat_at TIMESTAMP WITH TIME ZONE,
+            last_error TEXT,
+            run_after TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS jobs_status_run_after_idx ON jobs (status, run_after);
+
+        ALTER TABLE deployments
+            ADD COLUMN IF NOT EXISTS cancelled_by TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP WITH TIME ZONE;
+
+        ALTER TABLE jobs
+            ADD COLUMN IF NOT EXISTS cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+
+        CREATE INDEX IF NOT EXISTS build_logs_deployment_id_idx ON build_logs (deployment_id, id);
+
+        CREATE TABLE IF NOT EXISTS deployment_events (
+            id BIGSERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            type TEXT NOT NULL,
+            data JSONB NOT NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS deployment_events_deployment_id_idx ON deployment_events (deployment_id, id);
+
+        ALTER TABLE deployments
+            ADD COLUMN IF NOT EXISTS skipped_contracts JSONB NOT NULL DEFAULT '{}',
+            ADD COLUMN IF NOT EXISTS deployer_address TEXT NOT NULL DEFAULT '';
+
+        CREATE TABLE IF NOT EXISTS contract_deployments (
+            id SERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            name TEXT NOT NULL,
+            address TEXT NOT NULL,
+            transaction_hash TEXT NOT NULL,
+            network TEXT NOT NULL,
+            chain_id BIGINT NOT NULL,
+            block_number BIGINT NOT NULL,
+            gas_used BIGINT NOT NULL,
+            effective_gas_price NUMERIC(78, 0) NOT NULL,
+            cost_wei NUMERIC(78, 0) NOT NULL,
+            status TEXT NOT NULL,
+            deployed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS contract_deployments_deployment_id_idx ON contract_deployments (deployment_id, id);
+
+        ALTER TABLE deployments
+            ADD COLUMN IF NOT EXISTS total_cost_wei NUMERIC(78, 0) NOT NULL DEFAULT 0;
+
+        CREATE TABLE IF NOT EXISTS deployment_networks (
+            id SERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            network TEXT NOT NULL,
+            chain_id BIGINT NOT NULL DEFAULT 0,
+            status TEXT NOT NULL,
+            deployer_address TEXT NOT NULL DEFAULT '',
+            contract_addresses JSONB NOT NULL DEFAULT '{}',
+            transaction_hashes JSONB NOT NULL DEFAULT '[]',
+            gas_used BIGINT NOT NULL DEFAULT 0,
+            total_cost_wei NUMERIC(78, 0) NOT NULL DEFAULT 0,
+            error_message TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (deployment_id, network)
+        );
+
+        CREATE TABLE IF NOT EXISTS deployer_nonces (
+            chain_id BIGINT NOT NULL,
+            address TEXT NOT NULL,
+            next_nonce BIGINT NOT NULL,
+            released JSONB NOT NULL DEFAULT '[]',
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (chain_id, address)
+        );
+
+        CREATE TABLE IF NOT EXISTS deployment_transactions (
+            id SERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            network TEXT NOT NULL,
+            contract_name TEXT NOT NULL,
+            hash TEXT NOT NULL UNIQUE,
+            original_hash TEXT NOT NULL,
+            replaces TEXT NOT NULL DEFAULT '',
+            kind TEXT NOT NULL,
+            status TEXT NOT NULL,
+            from_address TEXT NOT NULL DEFAULT '',
+            nonce BIGINT NOT NULL DEFAULT 0,
+            gas_price TEXT NOT NULL DEFAULT '',
+            gas_fee_cap TEXT NOT NULL DEFAULT '',
+            gas_tip_cap TEXT NOT NULL DEFAULT '',
+            max_fee_per_gas TEXT NOT NULL DEFAULT '',
+            params JSONB,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS deployment_transactions_original_hash_idx ON deployment_transactions (original_hash);
+        CREATE INDEX IF NOT EXISTS deployment_transactions_deployment_id_idx ON deployment_transactions (deployment_id, id);
+
+        ALTER TABLE contract_deployments
+            ADD COLUMN IF NOT EXISTS constructor_args TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS verification_status TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS verification_guid TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS verification_message TEXT NOT NULL DEFAULT '';
+
+        ALTER TABLE contract_deployments
+            ADD COLUMN IF NOT EXISTS bytecode_match TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS bytecode_match_message TEXT NOT NULL DEFAULT '';
+
+        ALTER TABLE deployments
+            ADD COLUMN IF NOT EXISTS compilers JSONB NOT NULL DEFAULT '{}';
+
+        CREATE TABLE IF NOT EXISTS deployment_artifacts (
+            id SERIAL PRIMARY KEY,
+            deployment_id INTEGER REFERENCES deployments(id),
+            path TEXT NOT NULL,
+            hash TEXT NOT NULL,
+            size BIGINT NOT NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (deployment_id, path)
+        );
+
+        CREATE INDEX IF NOT EXISTS deployment_artifacts_hash_idx ON deployment_artifacts (hash);
     `)
-    return err
+    if err != nil {
+        return err
+    }
+
+    return createContractDeploymentsUniqueIndex(db)
+}
+
+// createContractDeploymentsUniqueIndex makes contract names unique per deployment
+// and network. Rows recorded twice before the index existed are removed first,
+// once, while the table is locked against concurrent writers and replicas.
+func createContractDeploymentsUniqueIndex(db *sql.DB) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec(`LOCK TABLE contract_deployments IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+        return err
+    }
+    var exists bool
+    err = tx.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM pg_indexes
+            WHERE schemaname = current_schema() AND indexname = 'contract_deployments_deployment_network_name_idx'
+        )`,
+    ).Scan(&exists)
+    if err != nil || exists {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        DELETE FROM contract_deployments a USING contract_deployments b
+        WHERE a.deployment_id = b.deployment_id AND a.network = b.network AND a.name = b.name AND a.id < b.id;
+
+        CREATE UNIQUE INDEX contract_deployments_deployment_network_name_idx
+            ON contract_deployments (deployment_id, network, name);
+    `)
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
 }
 
 // CreateDeployment creates a new deployment record
@@ -94,9 +285,11 @@ func (d *Database) CreateDeployment(deployment models.Deployment) (int, error) {
     return id, err
 }
 
-// UpdateDeployment updates an existing deployment
+// UpdateDeployment updates an existing deployment. Cancelled deployments are
+// left untouched and ErrDeploymentCancelled is returned, sql.ErrNoRows for a
+// deployment that does not exist.
 func (d *Database) UpdateDeployment(deployment models.Deployment) error {
-    _, err := d.db.Exec(`
+    res, err := d.db.Exec(`
         UPDATE deployments SET
             status = $1,
             url = $2,
@@ -104,52 +297,174 @@ func (d *Database) UpdateDeployment(deployment models.Deployment) error {
             transaction_hashes = $4,
             gas_used = $5,
             error_message = $6,
-            updated_at = $7
-        WHERE id = $8`,
+            contracts_path = $7,
+            frontend_path = $8,
+            deployment_type = $9,
+            blockchain_network = $10,
+            skipped_contracts = $11,
+            deployer_address = $12,
+            total_cost_wei = $13,
+            compilers = $14,
+            updated_at = $15
+        WHERE id = $16 AND status <> $17`,
         deployment.Status, deployment.URL, deployment.ContractAddresses,
         deployment.TransactionHashes, deployment.GasUsed, deployment.ErrorMessage,
-        deployment.UpdatedAt, deployment.ID,
+        deployment.ContractsPath, deployment.FrontendPath,
+        deployment.DeploymentType, deployment.BlockchainNetwork, deployment.SkippedContracts,
+        deployment.DeployerAddress, weiOrZero(deployment.TotalCostWei), deployment.Compilers,
+        deployment.UpdatedAt, deployment.ID, models.StatusCancelled,
     )
-    return err
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return d.notUpdatedError(deployment.ID)
+    }
+    d.publishStatus(deployment.ID, deployment.Status, deployment.ErrorMessage)
+    return nil
 }
 
-// UpdateDeploymentStatus updates only the status and error message
+// UpdateDeploymentStatus updates only the status and error message. Cancelled
+// deployments are left untouched and ErrDeploymentCancelled is returned,
+// sql.ErrNoRows for a deployment that does not exist.
 func (d *Database) UpdateDeploymentStatus(id int, status, errorMessage string) error {
-    _, err := d.db.Exec(`
+    res, err := d.db.Exec(`
         UPDATE deployments SET
             status = $1,
             error_message = $2,
             updated_at = CURRENT_TIMESTAMP
-        WHERE id = $3`,
-        status, errorMessage, id,
+        WHERE id = $3 AND status <> $4`,
+        status, errorMessage, id, models.StatusCancelled,
     )
-    return err
+    if err != nil {
+        return err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return d.notUpdatedError(id)
+    }
+    d.publishStatus(id, status, errorMessage)
+    return nil
 }
 
-// GetDeployment retrieves a deployment by ID
-func (d *Database) GetDeployment(id int) (models.Deployment, error) {
-    var deployment models.Deployment
-    err := d.db.QueryRow(`
-        SELECT id, project_name, status, url, deployment_type,
+// notUpdatedError explains why an update of a deployment changed no row: it
+// was cancelled, or it does not exist
+func (d *Database) notUpdatedError(id int) error {
+    var exists bool
+    err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM deployments WHERE id = $1)`, id).Scan(&exists)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return sql.ErrNoRows
+    }
+    return ErrDeploymentCancelled
+}
+
+// CancelDeployment marks a deployment cancelled and flags its job. Queued jobs
+// are cancelled outright, running ones are stopped by their worker's heartbeat.
+func (d *Database) CancelDeployment(id int, cancelledBy, reason string) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var status string
+    err = tx.QueryRow(`SELECT status FROM deployments WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+    if err != nil {
+        return err
+    }
+    switch status {
+    case models.StatusDeployed, models.StatusPartiallyDeployed, models.StatusEstimated, models.StatusFailed, models.StatusCancelled:
+        return ErrDeploymentFinished
+    }
+
+    message := "cancelled by " + cancelledBy
+    if reason != "" {
+        message += ": " + reason
+    }
+    _, err = tx.Exec(`
+        UPDATE deployments SET
+            status = $1,
+            error_message = $2,
+            cancelled_by = $3,
+            cancelled_at = CURRENT_TIMESTAMP,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $4`,
+        models.StatusCancelled, message, cancelledBy, id,
+    )
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE jobs SET
+            status = CASE WHEN status = $1 THEN $2 ELSE status END,
+            cancel_requested = TRUE,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE deployment_id = $3 AND status IN ($1, $4)`,
+        models.JobStatusQueued, models.JobStatusCancelled, id, models.JobStatusRunning,
+    )
+    if err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    d.publishStatus(id, models.StatusCancelled, message)
+    return nil
+}
+
+// deploymentColumns lists the columns read by scanDeployment, in order
+const deploymentColumns = `id, project_name, status, url, deployment_type,
             contract_addresses, transaction_hashes, blockchain_network,
-            gas_used, error_message, created_at, updated_at
-        FROM deployments WHERE id = $1`,
-        id,
-    ).Scan(
+            gas_used, total_cost_wei, error_message, contracts_path, frontend_path,
+            skipped_contracts, deployer_address, cancelled_by, cancelled_at,
+            created_at, updated_at, compilers`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanDeployment reads a row selected with deploymentColumns
+func scanDeployment(row rowScanner) (models.Deployment, error) {
+    var deployment models.Deployment
+    err := row.Scan(
         &deployment.ID, &deployment.ProjectName, &deployment.Status, &deployment.URL,
         &deployment.DeploymentType, &deployment.ContractAddresses, &deployment.TransactionHashes,
-        &deployment.BlockchainNetwork, &deployment.GasUsed, &deployment.ErrorMessage,
-        &deployment.CreatedAt, &deployment.UpdatedAt,
+        &deployment.BlockchainNetwork, &deployment.GasUsed, &deployment.TotalCostWei,
+        &deployment.ErrorMessage, &deployment.ContractsPath, &deployment.FrontendPath,
+        &deployment.SkippedContracts, &deployment.DeployerAddress, &deployment.CancelledBy,
+        &deployment.CancelledAt, &deployment.CreatedAt, &deployment.UpdatedAt,
+        &deployment.Compilers,
     )
+    deployment.TotalCost = FormatEther(deployment.TotalCostWei)
     return deployment, err
 }
 
+// weiOrZero defaults an unset cost to zero for the NUMERIC column
+func weiOrZero(wei string) string {
+    if wei == "" {
+        return "0"
+    }
+    return wei
+}
+
+// GetDeployment retrieves a deployment by ID
+func (d *Database) GetDeployment(id int) (models.Deployment, error) {
+    return scanDeployment(d.db.QueryRow(`
+        SELECT ` + deploymentColumns + `
+        FROM deployments WHERE id = $1`,
+        id,
+    ))
+}
+
 // GetDeployments retrieves all deployments
 func (d *Database) GetDeployments() ([]models.Deployment, error) {
     rows, err := d.db.Query(`
-        SELECT id, project_name, status, url, deployment_type,
-            contract_addresses, transaction_hashes, blockchain_network,
-            gas_used, error_message, created_at, updated_at
+        SELECT ` + deploymentColumns + `
         FROM deployments ORDER BY created_at DESC`,
     )
     if err != nil {
@@ -159,17 +474,322 @@ func (d *Database) GetDeployments() ([]models.Deployment, error) {
 
     var deployments []models.Deployment
     for rows.Next() {
-        var d models.Deployment
-        err := rows.Scan(
-            &d.ID, &d.ProjectName, &d.Status, &d.URL,
-            &d.DeploymentType, &d.ContractAddresses, &d.TransactionHashes,
-            &d.BlockchainNetwork, &d.GasUsed, &d.ErrorMessage,
-            &d.CreatedAt, &d.UpdatedAt,
-        )
+        d, err := scanDeployment(rows)
         if err != nil {
             return nil, err
         }
         deployments = append(deployments, d)
     }
     return deployments, nil
-}
\ No newline at end of file
+}
+
+// maxBuildLogBatch keeps inserts below the Postgres limit of 65535 parameters
+const maxBuildLogBatch = 1000
+
+// InsertBuildLogs stores build log entries, batching rows into multi-row inserts
+func (d *Database) InsertBuildLogs(logs []models.BuildLog) error {
+    if len(logs) == 0 {
+        return nil
+    }
+    if len(logs) > maxBuildLogBatch {
+        if err := d.InsertBuildLogs(logs[:maxBuildLogBatch]); err != nil {
+            return err
+        }
+        return d.InsertBuildLogs(logs[maxBuildLogBatch:])
+    }
+
+    placeholders := make([]string, 0, len(logs))
+    args := make([]interface{}, 0, len(logs)*5)
+    for i, entry := range logs {
+        n := i * 5
+        placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+        args = append(args, entry.DeploymentID, entry.Stage, entry.Message, entry.Level, entry.Timestamp)
+    }
+
+    _, err := d.db.Exec(`
+        INSERT INTO build_logs (deployment_id, stage, message, level, timestamp)
+        VALUES `+strings.Join(placeholders, ", "),
+        args...,
+    )
+    return err
+}
+
+// GetBuildLogs retrieves up to limit log entries of a deployment with an ID
+// greater than afterID, optionally restricted to one stage
+func (d *Database) GetBuildLogs(deploymentID, afterID, limit int, stage string) ([]models.BuildLog, error) {
+    rows, err := d.db.Query(`
+        SELECT id, deployment_id, stage, message, level, timestamp
+        FROM build_logs
+        WHERE deployment_id = $1 AND id > $2 AND ($3 = '' OR stage = $3)
+        ORDER BY id
+        LIMIT $4`,
+        deploymentID, afterID, stage, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    logs := []models.BuildLog{}
+    for rows.Next() {
+        var entry models.BuildLog
+        err := rows.Scan(
+            &entry.ID, &entry.DeploymentID, &entry.Stage,
+            &entry.Message, &entry.Level, &entry.Timestamp,
+        )
+        if err != nil {
+            return nil, err
+        }
+        logs = append(logs, entry)
+    }
+    return logs, rows.Err()
+}
+
+// RecordContractDeployments stores the contracts a deployment deployed to a
+// network and updates the gas used and total cost of the network to the sum
+// over its contracts, so transactions paid for before a failure or cancellation
+// are accounted for. The totals of the deployment follow its primary network.
+// A contract recorded again, e.g. by a retried job, replaces its earlier row.
+// The updated totals of the network are returned.
+func (d *Database) RecordContractDeployments(deploymentID int, network string, contracts []models.ContractDeployment) (int64, string, error) {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return 0, "", err
+    }
+    defer tx.Rollback()
+
+    for _, contract := range contracts {
+        if err := upsertContractDeployment(tx, deploymentID, contract); err != nil {
+            return 0, "", err
+        }
+    }
+
+    var gasUsed int64
+    var costWei string
+    err = tx.QueryRow(`
+        SELECT COALESCE(SUM(gas_used), 0), COALESCE(SUM(cost_wei), 0)
+        FROM contract_deployments WHERE deployment_id = $1 AND network = $2`,
+        deploymentID, network,
+    ).Scan(&gasUsed, &costWei)
+    if err != nil {
+        return 0, "", err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE deployment_networks SET
+            gas_used = $1,
+            total_cost_wei = $2,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE deployment_id = $3 AND network = $4`,
+        gasUsed, costWei, deploymentID, network,
+    )
+    if err != nil {
+        return 0, "", err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE deployments SET
+            gas_used = $1,
+            total_cost_wei = $2
+        WHERE id = $3 AND blockchain_network = $4`,
+        gasUsed, costWei, deploymentID, network,
+    )
+    if err != nil {
+        return 0, "", err
+    }
+    return gasUsed, costWei, tx.Commit()
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// upsertContractDeployment stores a contract deployed to a network, replacing
+// an earlier row of the same contract
+func upsertContractDeployment(db execer, deploymentID int, contract models.ContractDeployment) error {
+    _, err := db.Exec(`
+        INSERT INTO contract_deployments (
+            deployment_id, name, address, transaction_hash, network, chain_id,
+            block_number, gas_used, effective_gas_price, cost_wei, status, deployed_at,
+            constructor_args
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+        ON CONFLICT (deployment_id, network, name) DO UPDATE SET
+            address = EXCLUDED.address,
+            transaction_hash = EXCLUDED.transaction_hash,
+            chain_id = EXCLUDED.chain_id,
+            block_number = EXCLUDED.block_number,
+            gas_used = EXCLUDED.gas_used,
+            effective_gas_price = EXCLUDED.effective_gas_price,
+            cost_wei = EXCLUDED.cost_wei,
+            status = EXCLUDED.status,
+            deployed_at = EXCLUDED.deployed_at,
+            constructor_args = EXCLUDED.constructor_args`,
+        deploymentID, contract.Name, contract.Address, contract.TransactionHash,
+        contract.Network, contract.ChainID, contract.BlockNumber, contract.GasUsed,
+        weiOrZero(contract.EffectiveGasPrice), weiOrZero(contract.CostWei),
+        contract.Status, contract.DeployedAt, contract.ConstructorArgs,
+    )
+    return err
+}
+
+// RecordContractProgress stores a contract whose deployment is under way, so
+// a resumed job knows what was sent before. Totals are left to
+// RecordContractDeployments.
+func (d *Database) RecordContractProgress(deploymentID int, contract models.ContractDeployment) error {
+    return upsertContractDeployment(d.db, deploymentID, contract)
+}
+
+// GetContractDeployments retrieves the contracts deployed by a deployment, in deployment order
+func (d *Database) GetContractDeployments(deploymentID int) ([]models.ContractDeployment, error) {
+    rows, err := d.db.Query(`
+        SELECT id, deployment_id, name, address, transaction_hash, network, chain_id,
+            block_number, gas_used, effective_gas_price, cost_wei, status, deployed_at,
+            constructor_args, verification_status, verification_guid, verification_message,
+            bytecode_match, bytecode_match_message
+        FROM contract_deployments
+        WHERE deployment_id = $1
+        ORDER BY id`,
+        deploymentID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    contracts := []models.ContractDeployment{}
+    for rows.Next() {
+        var contract models.ContractDeployment
+        err := rows.Scan(
+            &contract.ID, &contract.DeploymentID, &contract.Name, &contract.Address,
+            &contract.TransactionHash, &contract.Network, &contract.ChainID,
+            &contract.BlockNumber, &contract.GasUsed, &contract.EffectiveGasPrice,
+            &contract.CostWei, &contract.Status, &contract.DeployedAt,
+            &contract.ConstructorArgs, &contract.VerificationStatus,
+            &contract.VerificationGUID, &contract.VerificationMessage,
+            &contract.BytecodeMatch, &contract.BytecodeMatchMessage,
+        )
+        if err != nil {
+            return nil, err
+        }
+        contract.Cost = FormatEther(contract.CostWei)
+        contracts = append(contracts, contract)
+    }
+    return contracts, rows.Err()
+}
+
+// UpdateContractVerification records the source verification of a contract
+// deployed to a network
+func (d *Database) UpdateContractVerification(deploymentID int, network, name, status, guid, message string) error {
+    _, err := d.db.Exec(`
+        UPDATE contract_deployments SET
+            verification_status = $1,
+            verification_guid = $2,
+            verification_message = $3
+        WHERE deployment_id = $4 AND network = $5 AND name = $6`,
+        status, guid, message, deploymentID, network, name,
+    )
+    return err
+}
+
+// UpdateContractBytecodeMatch records how the code of a contract deployed to a
+// network compares with its recompilation
+func (d *Database) UpdateContractBytecodeMatch(deploymentID int, network, name, match, message string) error {
+    _, err := d.db.Exec(`
+        UPDATE contract_deployments SET
+            bytecode_match = $1,
+            bytecode_match_message = $2
+        WHERE deployment_id = $3 AND network = $4 AND name = $5`,
+        match, message, deploymentID, network, name,
+    )
+    return err
+}
+
+// CreateDeploymentNetworks records the networks a deployment targets, the
+// first being its primary network. Networks of an earlier attempt of the
+// deployment are reset to pending.
+func (d *Database) CreateDeploymentNetworks(deploymentID int, networks []*models.Network) error {
+    tx, err := d.db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(`
+        UPDATE deployments SET blockchain_network = $1 WHERE id = $2`,
+        networks[0].Name, deploymentID,
+    )
+    if err != nil {
+        return err
+    }
+
+    for _, network := range networks {
+        _, err := tx.Exec(`
+            INSERT INTO deployment_networks (deployment_id, network, chain_id, status)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (deployment_id, network) DO UPDATE SET
+                status = EXCLUDED.status,
+                error_message = '',
+                updated_at = CURRENT_TIMESTAMP`,
+            deploymentID, network.Name, network.ChainID, models.StatusPending,
+        )
+        if err != nil {
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
+// UpdateDeploymentNetwork updates the outcome of a deployment on one network.
+// Gas used and cost are maintained by RecordContractDeployments.
+func (d *Database) UpdateDeploymentNetwork(network models.DeploymentNetwork) error {
+    _, err := d.db.Exec(`
+        UPDATE deployment_networks SET
+            status = $1,
+            chain_id = $2,
+            deployer_address = $3,
+            contract_addresses = $4,
+            transaction_hashes = $5,
+            error_message = $6,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE deployment_id = $7 AND network = $8`,
+        network.Status, network.ChainID, network.DeployerAddress,
+        network.ContractAddresses, network.TransactionHashes, network.ErrorMessage,
+        network.DeploymentID, network.Network,
+    )
+    return err
+}
+
+// GetDeploymentNetworks retrieves the networks of a deployment, primary network first
+func (d *Database) GetDeploymentNetworks(deploymentID int) ([]models.DeploymentNetwork, error) {
+    rows, err := d.db.Query(`
+        SELECT id, deployment_id, network, chain_id, status, deployer_address,
+            contract_addresses, transaction_hashes, gas_used, total_cost_wei,
+            error_message, created_at, updated_at
+        FROM deployment_networks
+        WHERE deployment_id = $1
+        ORDER BY id`,
+        deploymentID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    networks := []models.DeploymentNetwork{}
+    for rows.Next() {
+        var network models.DeploymentNetwork
+        err := rows.Scan(
+            &network.ID, &network.DeploymentID, &network.Network, &network.ChainID,
+            &network.Status, &network.DeployerAddress, &network.ContractAddresses,
+            &network.TransactionHashes, &network.GasUsed, &network.TotalCostWei,
+            &network.ErrorMessage, &network.CreatedAt, &network.UpdatedAt,
+        )
+        if err != nil {
+            return nil, err
+        }
+        network.TotalCost = FormatEther(network.TotalCostWei)
+        networks = append(networks, network)
+    }
+    return networks, rows.Err()
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"deploychain/models"
+)
+
+// Deployer runs deployment jobs: the build pipeline followed by contract deployment
+type Deployer struct {
+	db            *Database
+	daggerService *DaggerService
+	chains        *ChainBackends
+	networks      *NetworkRegistry
+	txs           *TxManager
+	confirmations *ConfirmationTracker
+	verifier      *Verifier
+	artifacts     *ArtifactStore
+}
+
+// NewDeployer creates a new deployer with service dependencies
+func NewDeployer(db *Database, dagger *DaggerService, chains *ChainBackends, networks *NetworkRegistry, txs *TxManager, artifacts *ArtifactStore) *Deployer {
+	return &Deployer{
+		db:            db,
+		daggerService: dagger,
+		chains:        chains,
+		networks:      networks,
+		txs:           txs,
+		confirmations: NewConfirmationTracker(),
+		verifier:      NewVerifier(),
+		artifacts:     artifacts,
+	}
+}
+
+// HandleJob is the JobHandler for deployment jobs. The build log is kept with
+// the artifacts of the deployment once the job ends, however it ends.
+func (d *Deployer) HandleJob(ctx context.Context, job *models.Job) error {
+	defer func() {
+		if err := d.artifacts.StoreLogs(context.Background(), job.DeploymentID); err != nil {
+			log.Printf("Failed to store build log of deployment %d: %v", job.DeploymentID, err)
+		}
+	}()
+
+	switch job.Kind {
+	case models.JobKindDeploy:
+		var payload models.DeployJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid deploy job payload: %v", err)
+		}
+		return d.deploy(ctx, job.DeploymentID, payload)
+	case models.JobKindEstimate:
+		var payload models.DeployJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid estimate job payload: %v", err)
+		}
+		return d.estimate(ctx, job.DeploymentID, payload)
+	default:
+		return fmt.Errorf("unknown job kind: %s", job.Kind)
+	}
+}
+
+// deploy builds the repository and deploys its contracts, recording the outcome on the deployment
+func (d *Deployer) deploy(ctx context.Context, deploymentID int, payload models.DeployJobPayload) error {
+	deployment, err := d.db.GetDeployment(deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to load deployment %d: %v", deploymentID, err)
+	}
+
+	if err := d.db.UpdateDeploymentStatus(deploymentID, models.StatusBuilding, ""); err != nil {
+		if errors.Is(err, ErrDeploymentCancelled) {
+			return err
+		}
+		log.Printf("Failed to update deployment status: %v", err)
+	}
+
+	logger := NewBuildLogger(d.db, deploymentID)
+	result, err := d.daggerService.RunPipeline(ctx, payload.RepoURL, payload.Branch, deploymentID, true, logger)
+	if ctx.Err() != nil {
+		logger.Warn(models.StagePipeline, "Deployment cancelled during build")
+		return ErrDeploymentCancelled
+	}
+	if err != nil {
+		log.Printf("Pipeline failed: %v", err)
+		d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+		return err
+	}
+
+	networks, targets, err := d.deploymentTargets(result)
+	if err != nil {
+		d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+		return err
+	}
+
+	// Update deployment with results
+	deployment.Status = models.StatusDeployed
+	deployment.DeploymentType = result.DeploymentType
+	deployment.BlockchainNetwork = networks[0].Name
+	deployment.URL = result.FrontendURL
+	deployment.ContractsPath = result.ContractsPath
+	deployment.FrontendPath = result.FrontendPath
+	deployment.UpdatedAt = time.Now()
+
+	// Deploy contracts to blockchain, static deployments only publish their frontend
+	var plan []DeployTarget
+	var runs []*networkRun
+	if result.DeploymentType != models.TypeStatic {
+		logger.StartStage(models.StageDeploy)
+		var skipped models.SkippedContractMap
+		plan, skipped, err = planDeployment(result.CompiledContracts, targets)
+		logSkippedContracts(logger, skipped)
+		if err != nil {
+			logger.Error(models.StageDeploy, "Invalid deployment plan: %v", err)
+			logger.EndStage(models.StageDeploy, err)
+			d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+			return err
+		}
+		deployment.SkippedContracts = skipped
+		deployment.Compilers = compilerSettings(plan)
+		if err := d.db.CreateDeploymentNetworks(deploymentID, networks); err != nil {
+			log.Printf("Failed to record deployment networks: %v", err)
+		}
+
+		names := make([]string, len(networks))
+		for i, network := range networks {
+			names[i] = network.Name
+		}
+		logger.Info(models.StageDeploy, "Deploying %d contracts to %s", len(plan), strings.Join(names, ", "))
+		for i, target := range plan {
+			logger.Info(models.StageDeploy, "%d. %s", i+1, target.Name)
+		}
+
+		// Every network is deployed to from the same artifacts, a failure on
+		// one network does not stop the others
+		runs = make([]*networkRun, len(networks))
+		for i, network := range networks {
+			runs[i] = &networkRun{
+				network: network,
+				backend: d.chains.Backend(network),
+				record: models.DeploymentNetwork{
+					DeploymentID: deploymentID,
+					Network:      network.Name,
+					ChainID:      network.ChainID,
+				},
+			}
+		}
+		tracker := newNetworkTracker(d, deploymentID, runs)
+
+		var maxFeeGwei float64
+		if manifest := result.Manifest; manifest != nil {
+			maxFeeGwei = manifest.Contracts.MaxFeeGwei
+		}
+		forEachRun(runs, func(run *networkRun) {
+			d.deployNetwork(ctx, run, plan, maxFeeGwei, tracker, logger)
+		})
+		if ctx.Err() != nil {
+			d.cancelRuns(runs, tracker, logger, models.StageDeploy)
+			logger.Warn(models.StageDeploy, "Deployment cancelled during contract deployment")
+			logger.EndStage(models.StageDeploy, ErrDeploymentCancelled)
+			return ErrDeploymentCancelled
+		}
+		logger.EndStage(models.StageDeploy, runsError(runs))
+
+		// Only report a network deployed once its transactions are unlikely to be reorged away
+		logger.StartStage(models.StageConfirm)
+		forEachRun(runs, func(run *networkRun) {
+			if run.err == nil {
+				d.confirmNetwork(ctx, run, tracker, logger)
+			}
+		})
+		if ctx.Err() != nil {
+			d.cancelRuns(runs, tracker, logger, models.StageConfirm)
+			logger.Warn(models.StageConfirm, "Deployment cancelled while waiting for confirmations")
+			logger.EndStage(models.StageConfirm, ErrDeploymentCancelled)
+			return ErrDeploymentCancelled
+		}
+		err = runsError(runs)
+		logger.EndStage(models.StageConfirm, err)
+
+		// The deployment level fields describe the primary network
+		primary := runs[0].record
+		deployment.DeployerAddress = primary.DeployerAddress
+		deployment.ContractAddresses = primary.ContractAddresses
+		deployment.TransactionHashes = primary.TransactionHashes
+		deployment.GasUsed = primary.GasUsed
+		deployment.TotalCostWei = primary.TotalCostWei
+
+		if err != nil {
+			deployed := 0
+			for _, run := range runs {
+				if run.err == nil {
+					deployed++
+				}
+			}
+			deployment.ErrorMessage = err.Error()
+			if deployed == 0 {
+				log.Printf("Contract deployment failed: %v", err)
+				d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+				return err
+			}
+			logger.Warn(models.StagePipeline, "Deployed to %d of %d networks: %v", deployed, len(runs), err)
+			deployment.Status = models.StatusPartiallyDeployed
+		}
+	}
+
+	if err := d.db.UpdateDeployment(deployment); err != nil {
+		return fmt.Errorf("failed to update deployment: %v", err)
+	}
+	d.verifyDeployment(ctx, runs, plan, logger)
+	return nil
+}
+
+// deploymentTargets returns the networks a build is deployed to, primary network
+// first, and the contracts its manifest lists
+func (d *Deployer) deploymentTargets(result models.BuildResult) ([]*models.Network, []models.ContractTarget, error) {
+	networkNames := []string{d.networks.Default()}
+	var targets []models.ContractTarget
+	if manifest := result.Manifest; manifest != nil {
+		networkNames = manifest.Networks
+		targets = manifest.Contracts.Deploy
+	}
+	networks := make([]*models.Network, len(networkNames))
+	for i, name := range networkNames {
+		network, ok := d.networks.Get(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown network %q", name)
+		}
+		networks[i] = network
+	}
+	return networks, targets, nil
+}
+
+// setStatus moves a deployment to an intermediate status, logging failures
+func (d *Deployer) setStatus(deploymentID int, status string) {
+	if err := d.db.UpdateDeploymentStatus(deploymentID, status, ""); err != nil && !errors.Is(err, ErrDeploymentCancelled) {
+		log.Printf("Failed to update deployment status: %v", err)
+	}
+}
+
+// compilerSettings returns the compiler settings of every planned contract
+func compilerSettings(plan []DeployTarget) models.CompilerSettingsMap {
+	settings := make(models.CompilerSettingsMap, len(plan))
+	for _, target := range plan {
+		settings[target.Name] = target.Contract.Compiler()
+	}
+	return settings
+}
+
+// logSkippedContracts records the compiled contracts left out of the deployment
+func logSkippedContracts(logger *BuildLogger, skipped models.SkippedContractMap) {
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		logger.Info(models.StageDeploy, "Skipping %s: %s", name, skipped[name])
+	}
+}
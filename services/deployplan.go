@@ -0,0 +1,246 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"deploychain/models"
+)
+
+// addressRefPattern matches ${Name.address} placeholders in constructor arguments
+var addressRefPattern = regexp.MustCompile(`\$\{([A-Za-z_$][A-Za-z0-9_$]*)\.address\}`)
+
+// placeholderAddress stands in for unresolved references when validating arguments
+const placeholderAddress = "0x0000000000000000000000000000000000000000"
+
+// DeployTarget is a contract scheduled for deployment with its constructor arguments
+type DeployTarget struct {
+	Name     string
+	Contract *models.CompiledContract
+	Args     []interface{}
+	// DependsOn lists the contracts that must be deployed first
+	DependsOn []string
+}
+
+// planDeployment selects the contracts to deploy and orders them so that every
+// contract follows the contracts it references. Without targets the deployable
+// contracts are inferred from the artifacts and deployed in name order. The
+// compiled contracts left out are returned with the reason.
+func planDeployment(compiled map[string]*models.CompiledContract, targets []models.ContractTarget) ([]DeployTarget, models.SkippedContractMap, error) {
+	var plan []DeployTarget
+	if len(targets) == 0 {
+		deployable, skipped := selectDeployable(compiled)
+		if len(deployable) == 0 {
+			return nil, skipped, fmt.Errorf("no deployable contracts found among %d compiled artifacts", len(compiled))
+		}
+		names := make([]string, 0, len(deployable))
+		for name := range deployable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			plan = append(plan, DeployTarget{Name: name, Contract: deployable[name]})
+		}
+		return plan, skipped, nil
+	}
+
+	listed := make(map[string]bool)
+	var missing []string
+	for _, target := range targets {
+		listed[target.Name] = true
+		contract, ok := compiled[target.Name]
+		if !ok {
+			missing = append(missing, target.Name)
+			continue
+		}
+		if reason := undeployableReason(contract); reason != "" {
+			return nil, nil, fmt.Errorf("%s cannot be deployed: %s", target.Name, reason)
+		}
+		plan = append(plan, DeployTarget{
+			Name:      target.Name,
+			Contract:  contract,
+			Args:      target.Args,
+			DependsOn: dependencies(target),
+		})
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("contracts listed in the manifest were not compiled: %s", strings.Join(missing, ", "))
+	}
+
+	skipped := make(models.SkippedContractMap)
+	for name, contract := range compiled {
+		if listed[name] {
+			continue
+		}
+		if reason := classifyContract(contract); reason != "" {
+			skipped[name] = reason
+		} else {
+			skipped[name] = skipNotListed
+		}
+	}
+
+	ordered, err := orderTargets(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check the arguments against the ABIs before anything is sent
+	placeholders := make(models.ContractAddressMap)
+	for _, target := range ordered {
+		placeholders[target.Name] = placeholderAddress
+	}
+	for _, target := range ordered {
+		args, err := resolveAddressRefs(target.Args, placeholders)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", target.Name, err)
+		}
+		if _, err := encodeConstructorArgs(target.Contract.ABI, args); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", target.Name, err)
+		}
+	}
+	return ordered, skipped, nil
+}
+
+// dependencies returns the contracts a target references or explicitly depends on
+func dependencies(target models.ContractTarget) []string {
+	seen := make(map[string]bool)
+	var deps []string
+	for _, dep := range append(addressRefs(target.Args), target.DependsOn...) {
+		if !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// orderTargets sorts targets topologically, keeping the listed order where the
+// dependencies allow it
+func orderTargets(targets []DeployTarget) ([]DeployTarget, error) {
+	index := make(map[string]int, len(targets))
+	for i, target := range targets {
+		index[target.Name] = i
+	}
+	pending := make([]int, len(targets))
+	for i, target := range targets {
+		for _, dep := range target.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("%s depends on %s, which is not deployed", target.Name, dep)
+			}
+			if dep == target.Name {
+				return nil, fmt.Errorf("%s depends on itself", target.Name)
+			}
+		}
+		pending[i] = len(target.DependsOn)
+	}
+
+	ordered := make([]DeployTarget, 0, len(targets))
+	done := make([]bool, len(targets))
+	for len(ordered) < len(targets) {
+		next := -1
+		for i := range targets {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, target := range targets {
+				if !done[i] {
+					cycle = append(cycle, target.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+		}
+
+		done[next] = true
+		ordered = append(ordered, targets[next])
+		for i, target := range targets {
+			for _, dep := range target.DependsOn {
+				if dep == targets[next].Name {
+					pending[i]--
+				}
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// addressRefs returns the contract names referenced by ${Name.address} placeholders in value
+func addressRefs(value interface{}) []string {
+	var refs []string
+	switch v := value.(type) {
+	case string:
+		for _, match := range addressRefPattern.FindAllStringSubmatch(v, -1) {
+			refs = append(refs, match[1])
+		}
+	case []interface{}:
+		for _, item := range v {
+			refs = append(refs, addressRefs(item)...)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			refs = append(refs, addressRefs(item)...)
+		}
+	}
+	return refs
+}
+
+// resolveAddressRefs replaces ${Name.address} placeholders with deployed addresses
+func resolveAddressRefs(args []interface{}, addresses models.ContractAddressMap) ([]interface{}, error) {
+	resolved, err := resolveValue(args, addresses)
+	if err != nil {
+		return nil, err
+	}
+	if resolved == nil {
+		return []interface{}{}, nil
+	}
+	return resolved.([]interface{}), nil
+}
+
+func resolveValue(value interface{}, addresses models.ContractAddressMap) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var missing string
+		resolved := addressRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			name := addressRefPattern.FindStringSubmatch(ref)[1]
+			address, ok := addresses[name]
+			if !ok {
+				missing = name
+			}
+			return address
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("no address for %s", missing)
+		}
+		return resolved, nil
+	case []interface{}:
+		if v == nil {
+			return nil, nil
+		}
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := resolveValue(item, addresses)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := resolveValue(item, addresses)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"deploychain/models"
+)
+
+func TestOrderTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []DeployTarget
+		want    []string
+		err     string
+	}{
+		{
+			name:    "keeps the listed order without dependencies",
+			targets: []DeployTarget{{Name: "B"}, {Name: "A"}, {Name: "C"}},
+			want:    []string{"B", "A", "C"},
+		},
+		{
+			name:    "moves dependencies first",
+			targets: []DeployTarget{{Name: "Marketplace", DependsOn: []string{"Token"}}, {Name: "Token"}},
+			want:    []string{"Token", "Marketplace"},
+		},
+		{
+			name: "keeps the listed order where dependencies allow it",
+			targets: []DeployTarget{
+				{Name: "Router", DependsOn: []string{"Factory", "WETH"}},
+				{Name: "WETH"},
+				{Name: "Factory"},
+				{Name: "Oracle"},
+			},
+			want: []string{"WETH", "Factory", "Router", "Oracle"},
+		},
+		{
+			name:    "diamond",
+			targets: []DeployTarget{{Name: "D", DependsOn: []string{"B", "C"}}, {Name: "C", DependsOn: []string{"A"}}, {Name: "B", DependsOn: []string{"A"}}, {Name: "A"}},
+			want:    []string{"A", "C", "B", "D"},
+		},
+		{
+			name:    "unknown dependency",
+			targets: []DeployTarget{{Name: "Marketplace", DependsOn: []string{"Token"}}},
+			err:     "Marketplace depends on Token, which is not deployed",
+		},
+		{
+			name:    "self dependency",
+			targets: []DeployTarget{{Name: "Token", DependsOn: []string{"Token"}}},
+			err:     "Token depends on itself",
+		},
+		{
+			name:    "cycle",
+			targets: []DeployTarget{{Name: "A", DependsOn: []string{"B"}}, {Name: "B", DependsOn: []string{"A"}}, {Name: "C"}},
+			err:     "dependency cycle between A, B",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ordered, err := orderTargets(test.targets)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("orderTargets() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orderTargets() error = %v", err)
+			}
+			var got []string
+			for _, target := range ordered {
+				got = append(got, target.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("orderTargets() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveAddressRefs(t *testing.T) {
+	const token = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	addresses := models.ContractAddressMap{"Token": token, "Vault_2": "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"}
+
+	tests := []struct {
+		name string
+		args []interface{}
+		want []interface{}
+		err  string
+	}{
+		{
+			name: "no arguments",
+			want: []interface{}{},
+		},
+		{
+			name: "leaves other values alone",
+			args: []interface{}{"My Token", 250, 1.5, true, "$Token.address", "{Token.address}"},
+			want: []interface{}{"My Token", 250, 1.5, true, "$Token.address", "{Token.address}"},
+		},
+		{
+			name: "whole argument",
+			args: []interface{}{"${Token.address}", 250},
+			want: []interface{}{token, 250},
+		},
+		{
+			name: "within a string",
+			args: []interface{}{"token=${Token.address};vault=${Vault_2.address}"},
+			want: []interface{}{"token=" + token + ";vault=0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"},
+		},
+		{
+			name: "nested in lists and tuples",
+			args: []interface{}{[]interface{}{"${Token.address}"}, map[string]interface{}{"asset": "${Token.address}", "fee": 30}},
+			want: []interface{}{[]interface{}{token}, map[string]interface{}{"asset": token, "fee": 30}},
+		},
+		{
+			name: "unknown contract",
+			args: []interface{}{[]interface{}{"${Missing.address}"}},
+			err:  "no address for Missing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveAddressRefs(test.args, addresses)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("resolveAddressRefs() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAddressRefs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("resolveAddressRefs() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"deploychain/models"
+)
+
+// estimate builds the repository and projects the gas and cost of deploying
+// its contracts to each network at current fee levels, without broadcasting.
+// The projections are recorded as the deployment's contracts, so they can be
+// compared with those of an actual deployment of the same build.
+func (d *Deployer) estimate(ctx context.Context, deploymentID int, payload models.DeployJobPayload) error {
+	deployment, err := d.db.GetDeployment(deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to load deployment %d: %v", deploymentID, err)
+	}
+
+	if err := d.db.UpdateDeploymentStatus(deploymentID, models.StatusBuilding, ""); err != nil {
+		if errors.Is(err, ErrDeploymentCancelled) {
+			return err
+		}
+		log.Printf("Failed to update deployment status: %v", err)
+	}
+
+	// Nothing is published, so the frontend is not built
+	logger := NewBuildLogger(d.db, deploymentID)
+	result, err := d.daggerService.RunPipeline(ctx, payload.RepoURL, payload.Branch, deploymentID, false, logger)
+	if ctx.Err() != nil {
+		logger.Warn(models.StagePipeline, "Estimate cancelled during build")
+		return ErrDeploymentCancelled
+	}
+	if err != nil {
+		log.Printf("Pipeline failed: %v", err)
+		d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+		return err
+	}
+
+	networks, targets, err := d.deploymentTargets(result)
+	if err != nil {
+		d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+		return err
+	}
+
+	deployment.Status = models.StatusEstimated
+	deployment.DeploymentType = models.TypeEstimate
+	deployment.BlockchainNetwork = networks[0].Name
+	deployment.ContractsPath = result.ContractsPath
+	deployment.FrontendPath = result.FrontendPath
+	deployment.UpdatedAt = time.Now()
+
+	if result.DeploymentType != models.TypeStatic {
+		logger.StartStage(models.StageEstimate)
+		plan, skipped, err := planDeployment(result.CompiledContracts, targets)
+		logSkippedContracts(logger, skipped)
+		if err != nil {
+			logger.Error(models.StageEstimate, "Invalid deployment plan: %v", err)
+			logger.EndStage(models.StageEstimate, err)
+			d.db.UpdateDeploymentStatus(deploymentID, models.StatusFailed, err.Error())
+			return err
+		}
+		deployment.SkippedContracts = skipped
+		deployment.Compilers = compilerSettings(plan)
+		if err := d.db.CreateDeploymentNetworks(deploymentID, networks); err != nil {
+			log.Printf("Failed to record deployment networks: %v", err)
+		}
+
+		runs := make([]*networkRun, len(networks))
+		for i, network := range networks {
+			runs[i] = &networkRun{
+				network: network,
+				backend: d.chains.Backend(network),
+				record: models.DeploymentNetwork{
+					DeploymentID: deploymentID,
+					Network:      network.Name,
+					ChainID:      network.ChainID,
+				},
+			}
+		}
+		forEachRun(runs, func(run *networkRun) {
+			d.estimateNetwork(ctx, run, plan, logger)
+		})
+		if ctx.Err() != nil {
+			logger.Warn(models.StageEstimate, "Estimate cancelled")
+			logger.EndStage(models.StageEstimate, ErrDeploymentCancelled)
+			return ErrDeploymentCancelled
+		}
+		err = runsError(runs)
+		logger.EndStage(models.StageEstimate, err)
+
+		primary := runs[0].record
+		deployment.DeployerAddress = primary.DeployerAddress
+		deployment.GasUsed = primary.GasUsed
+		deployment.TotalCostWei = primary.TotalCostWei
+		if err != nil {
+			deployment.Status = models.StatusFailed
+			deployment.ErrorMessage = err.Error()
+		}
+	}
+
+	if err := d.db.UpdateDeployment(deployment); err != nil {
+		return fmt.Errorf("failed to update deployment: %v", err)
+	}
+	if deployment.Status == models.StatusFailed {
+		return errors.New(deployment.ErrorMessage)
+	}
+	return nil
+}
+
+// estimateNetwork projects the cost of deploying the planned contracts to the
+// network of a run
+func (d *Deployer) estimateNetwork(ctx context.Context, run *networkRun, plan []DeployTarget, logger *BuildLogger) {
+	network := run.network
+	fail := func(err error) {
+		run.err = fmt.Errorf("%s: %v", network.Name, err)
+		run.record.Status = models.StatusFailed
+		run.record.ErrorMessage = err.Error()
+		if err := d.db.UpdateDeploymentNetwork(run.record); err != nil {
+			log.Printf("Failed to update %s deployment status: %v", network.Name, err)
+		}
+	}
+
+	deployer, err := run.backend.DeployerAddress(ctx)
+	if err != nil {
+		logger.Error(models.StageEstimate, "[%s] No deployer account: %v", network.Name, err)
+		fail(err)
+		return
+	}
+	run.record.DeployerAddress = deployer
+	logger.Info(models.StageEstimate, "[%s] Estimating %d contracts via %s from %s", network.Name, len(plan), run.backend.Name(), deployer)
+
+	contracts, err := EstimateContracts(ctx, run.backend, network, deployer, plan)
+	gasUsed, totalCostWei, recordErr := d.db.RecordContractDeployments(run.record.DeploymentID, network.Name, contracts)
+	if recordErr != nil {
+		log.Printf("Failed to record estimates on %s: %v", network.Name, recordErr)
+	} else {
+		run.record.GasUsed = gasUsed
+		run.record.TotalCostWei = totalCostWei
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	symbol := network.NativeCurrency.Symbol
+	for _, contract := range contracts {
+		logger.Info(models.StageEstimate, "[%s] %s: %d gas at %s wei, cost %s %s",
+			network.Name, contract.Name, contract.GasUsed, contract.EffectiveGasPrice, contract.Cost, symbol)
+	}
+	logger.Info(models.StageEstimate, "[%s] Projected total %d gas, cost %s %s",
+		network.Name, run.record.GasUsed, FormatUnits(run.record.TotalCostWei, network.NativeCurrency.Decimals), symbol)
+	if err != nil {
+		logger.Error(models.StageEstimate, "[%s] Estimate incomplete: %v", network.Name, err)
+		fail(err)
+		return
+	}
+
+	run.record.Status = models.StatusEstimated
+	if err := d.db.UpdateDeploymentNetwork(run.record); err != nil {
+		log.Printf("Failed to update %s deployment status: %v", network.Name, err)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deploychain/models"
+
+	"github.com/lib/pq"
+)
+
+// eventChannel is the Postgres NOTIFY channel carrying "<deployment id>:<event id>"
+const eventChannel = "deployment_events"
+
+// subscriberBuffer is how many events a slow subscriber may lag behind before
+// it is disconnected and has to resume with Last-Event-ID
+const subscriberBuffer = 256
+
+// PublishEvent stores a deployment event and notifies every API replica of it
+func (d *Database) PublishEvent(deploymentID int, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`
+		WITH event AS (
+			INSERT INTO deployment_events (deployment_id, type, data)
+			VALUES ($1, $2, $3)
+			RETURNING id, deployment_id
+		)
+		SELECT pg_notify($4, event.deployment_id || ':' || event.id) FROM event`,
+		deploymentID, eventType, payload, eventChannel,
+	)
+	return err
+}
+
+// GetEvent retrieves a single deployment event
+func (d *Database) GetEvent(id int64) (models.DeploymentEvent, error) {
+	var event models.DeploymentEvent
+	err := d.db.QueryRow(`
+		SELECT id, deployment_id, type, data, created_at
+		FROM deployment_events WHERE id = $1`,
+		id,
+	).Scan(&event.ID, &event.DeploymentID, &event.Type, &event.Data, &event.CreatedAt)
+	return event, err
+}
+
+// GetEventsAfter retrieves the events of a deployment with an ID greater than afterID
+func (d *Database) GetEventsAfter(deploymentID int, afterID int64) ([]models.DeploymentEvent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, deployment_id, type, data, created_at
+		FROM deployment_events
+		WHERE deployment_id = $1 AND id > $2
+		ORDER BY id`,
+		deploymentID, afterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.DeploymentEvent
+	for rows.Next() {
+		var event models.DeploymentEvent
+		if err := rows.Scan(&event.ID, &event.DeploymentID, &event.Type, &event.Data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// publishStatus emits a status transition event, logging rather than failing on error
+func (d *Database) publishStatus(deploymentID int, status, errorMessage string) {
+	data := map[string]string{"status": status}
+	if errorMessage != "" {
+		data["error"] = errorMessage
+	}
+	if err := d.PublishEvent(deploymentID, models.EventStatus, data); err != nil {
+		log.Printf("Failed to publish status event for deployment %d: %v", deploymentID, err)
+	}
+}
+
+// EventBroker fans deployment events out to in-process subscribers. Events
+// arrive through Postgres LISTEN so subscribers see events from any replica.
+type EventBroker struct {
+	db          *Database
+	listener    *pq.Listener
+	mu          sync.Mutex
+	subscribers map[int]map[chan models.DeploymentEvent]struct{}
+}
+
+// NewEventBroker creates an event broker listening on the DATABASE_URL connection
+func NewEventBroker(db *Database) *EventBroker {
+	listener := pq.NewListener(os.Getenv("DATABASE_URL"), 10*time.Second, time.Minute,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Event listener: %v", err)
+			}
+		})
+
+	return &EventBroker{
+		db:          db,
+		listener:    listener,
+		subscribers: make(map[int]map[chan models.DeploymentEvent]struct{}),
+	}
+}
+
+// Start listens for event notifications until ctx is done
+func (b *EventBroker) Start(ctx context.Context) error {
+	if err := b.listener.Listen(eventChannel); err != nil {
+		return fmt.Errorf("failed to listen for deployment events: %w", err)
+	}
+
+	go func() {
+		defer b.listener.Close()
+		ping := time.NewTicker(90 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-b.listener.Notify:
+				if notification == nil {
+					// The connection was re-established and notifications may have
+					// been lost, make subscribers resume from the database
+					b.disconnectAll()
+					continue
+				}
+				b.dispatch(notification.Extra)
+			case <-ping.C:
+				go b.listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Subscribe registers for live events of a deployment. The channel is closed
+// when the subscriber falls behind; it should then resume from the database.
+func (b *EventBroker) Subscribe(deploymentID int) (<-chan models.DeploymentEvent, func()) {
+	ch := make(chan models.DeploymentEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[deploymentID] == nil {
+		b.subscribers[deploymentID] = make(map[chan models.DeploymentEvent]struct{})
+	}
+	b.subscribers[deploymentID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(deploymentID, ch)
+	}
+	return ch, unsubscribe
+}
+
+// dispatch loads a notified event and sends it to the deployment's subscribers
+func (b *EventBroker) dispatch(payload string) {
+	deploymentPart, eventPart, ok := strings.Cut(payload, ":")
+	if !ok {
+		return
+	}
+	deploymentID, err := strconv.Atoi(deploymentPart)
+	if err != nil {
+		return
+	}
+	eventID, err := strconv.ParseInt(eventPart, 10, 64)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	hasSubscribers := len(b.subscribers[deploymentID]) > 0
+	b.mu.Unlock()
+	if !hasSubscribers {
+		return
+	}
+
+	event, err := b.db.GetEvent(eventID)
+	if err != nil {
+		log.Printf("Failed to load deployment event %d: %v", eventID, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[deploymentID] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(deploymentID, ch)
+		}
+	}
+}
+
+// disconnectAll closes every subscriber channel
+func (b *EventBroker) disconnectAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for deploymentID, channels := range b.subscribers {
+		for ch := range channels {
+			b.remove(deploymentID, ch)
+		}
+	}
+}
+
+// remove closes and unregisters a subscriber, callers must hold b.mu
+func (b *EventBroker) remove(deploymentID int, ch chan models.DeploymentEvent) {
+	channels := b.subscribers[deploymentID]
+	if _, ok := channels[ch]; !ok {
+		return
+	}
+	delete(channels, ch)
+	close(ch)
+	if len(channels) == 0 {
+		delete(b.subscribers, deploymentID)
+	}
+}
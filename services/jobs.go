@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"deploychain/models"
+)
+
+// ErrLeaseLost is returned when a job's lease has been taken over by another worker
+var ErrLeaseLost = errors.New("job lease lost")
+
+// jobColumns lists the columns read by scanJob, in order
+const jobColumns = `id, deployment_id, kind, payload, status, attempts, max_attempts,
+	COALESCE(lease_owner, ''), lease_expires_at, COALESCE(last_error, ''), created_at, updated_at`
+
+// scanJob reads a row selected with jobColumns
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(
+		&job.ID, &job.DeploymentID, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.LeaseOwner, &job.LeaseExpiresAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CreateDeploymentWithJob creates a deployment record and queues its job in one transaction
+func (d *Database) CreateDeploymentWithJob(deployment models.Deployment, kind string, payload interface{}) (int, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO deployments (
+			project_name, status, url, deployment_type,
+			contract_addresses, transaction_hashes, blockchain_network,
+			gas_used, error_message, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		deployment.ProjectName, deployment.Status, deployment.URL, deployment.DeploymentType,
+		deployment.ContractAddresses, deployment.TransactionHashes, deployment.BlockchainNetwork,
+		deployment.GasUsed, deployment.ErrorMessage, deployment.CreatedAt, deployment.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO jobs (deployment_id, kind, payload, status)
+		VALUES ($1, $2, $3, $4)`,
+		id, kind, payloadJSON, models.JobStatusQueued,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// ClaimJob leases the oldest runnable job to owner, returning nil if the queue is empty.
+// SKIP LOCKED lets several workers and API replicas poll the same table.
+func (d *Database) ClaimJob(owner string, lease time.Duration) (*models.Job, error) {
+	job, err := scanJob(d.db.QueryRow(`
+		UPDATE jobs SET
+			status = $1,
+			lease_owner = $2,
+			lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3),
+			heartbeat_at = CURRENT_TIMESTAMP,
+			attempts = attempts + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = $4 AND run_after <= CURRENT_TIMESTAMP
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING `+jobColumns,
+		models.JobStatusRunning, owner, lease.Seconds(), models.JobStatusQueued,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// HeartbeatJob extends the lease of a running job held by owner and reports
+// whether cancellation of the job has been requested
+func (d *Database) HeartbeatJob(id int, owner string, lease time.Duration) (bool, error) {
+	var cancelRequested bool
+	err := d.db.QueryRow(`
+		UPDATE jobs SET
+			lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $1),
+			heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND lease_owner = $3 AND status = $4
+		RETURNING cancel_requested`,
+		lease.Seconds(), id, owner, models.JobStatusRunning,
+	).Scan(&cancelRequested)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrLeaseLost
+	}
+	return cancelRequested, err
+}
+
+// FinishJob releases a job held by owner with its final status
+func (d *Database) FinishJob(id int, owner, status, lastError string) error {
+	_, err := d.db.Exec(`
+		UPDATE jobs SET
+			status = $1,
+			last_error = $2,
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND lease_owner = $4`,
+		status, lastError, id, owner,
+	)
+	return err
+}
+
+// RecoverOrphanedJobs requeues running jobs whose lease expired because their
+// worker died. Deployments resume from the contract progress they recorded,
+// see DeployContracts. Jobs out of attempts are failed together with their
+// deployment.
+func (d *Database) RecoverOrphanedJobs() (requeued int64, failed int64, err error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE jobs SET
+			status = $1,
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE status = $2 AND lease_expires_at < CURRENT_TIMESTAMP AND cancel_requested`,
+		models.JobStatusCancelled, models.JobStatusRunning,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	res, err := tx.Exec(`
+		WITH exhausted AS (
+			UPDATE jobs SET
+				status = $1,
+				last_error = 'lease expired after final attempt',
+				lease_owner = NULL,
+				lease_expires_at = NULL,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE status = $2 AND lease_expires_at < CURRENT_TIMESTAMP AND attempts >= max_attempts
+			RETURNING deployment_id
+		)
+		UPDATE deployments SET
+			status = $3,
+			error_message = 'deployment worker stopped responding',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT deployment_id FROM exhausted)`,
+		models.JobStatusFailed, models.JobStatusRunning, models.StatusFailed,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	failed, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`
+		UPDATE jobs SET
+			status = $1,
+			lease_owner = NULL,
+			lease_expires_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE status = $2 AND lease_expires_at < CURRENT_TIMESTAMP`,
+		models.JobStatusQueued, models.JobStatusRunning,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	requeued, _ = res.RowsAffected()
+
+	return requeued, failed, tx.Commit()
+}
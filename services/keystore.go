@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// keystoreFile is a Web3 Secret Storage (version 3) key file, as written by geth, Foundry's cast wallet and ethers
+type keystoreFile struct {
+	Address string         `json:"address"`
+	Crypto  keystoreCrypto `json:"crypto"`
+	// Older geth versions capitalize the crypto section
+	LegacyCrypto *keystoreCrypto `json:"Crypto"`
+	Version      int             `json:"version"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string `json:"cipher"`
+	CipherText   string `json:"ciphertext"`
+	CipherParams struct {
+		IV string `json:"iv"`
+	} `json:"cipherparams"`
+	KDF       string `json:"kdf"`
+	KDFParams struct {
+		DKLen int    `json:"dklen"`
+		Salt  string `json:"salt"`
+		N     int    `json:"n"`
+		R     int    `json:"r"`
+		P     int    `json:"p"`
+		C     int    `json:"c"`
+		PRF   string `json:"prf"`
+	} `json:"kdfparams"`
+	MAC string `json:"mac"`
+}
+
+// NewKeystoreSigner decrypts an encrypted keystore file and returns a signer for its key
+func NewKeystoreSigner(path, password string) (*KeySigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %v", err)
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid keystore %s: %v", path, err)
+	}
+	key, err := decryptKeystore(&file, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore %s: %v", path, err)
+	}
+	signer, err := NewKeySigner(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Address != "" && !strings.EqualFold(strings.TrimPrefix(file.Address, "0x"), strings.TrimPrefix(signer.Address(), "0x")) {
+		return nil, fmt.Errorf("keystore %s: decrypted key does not match address %s", path, file.Address)
+	}
+	return signer, nil
+}
+
+// decryptKeystore returns the private key of a version 3 keystore
+func decryptKeystore(file *keystoreFile, password string) ([]byte, error) {
+	if file.Version != 3 {
+		return nil, fmt.Errorf("unsupported keystore version %d", file.Version)
+	}
+	c := file.Crypto
+	if c.Cipher == "" && file.LegacyCrypto != nil {
+		c = *file.LegacyCrypto
+	}
+	if c.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("unsupported cipher %q", c.Cipher)
+	}
+
+	salt, err := hex.DecodeString(c.KDFParams.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	var derivedKey []byte
+	switch c.KDF {
+	case "scrypt":
+		derivedKey, err = scrypt.Key([]byte(password), salt, c.KDFParams.N, c.KDFParams.R, c.KDFParams.P, c.KDFParams.DKLen)
+		if err != nil {
+			return nil, err
+		}
+	case "pbkdf2":
+		if c.KDFParams.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported pbkdf2 prf %q", c.KDFParams.PRF)
+		}
+		derivedKey, err = pbkdf2.Key(sha256.New, password, salt, c.KDFParams.C, c.KDFParams.DKLen)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kdf %q", c.KDF)
+	}
+	if len(derivedKey) < 32 {
+		return nil, fmt.Errorf("derived key too short")
+	}
+
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	mac, err := hex.DecodeString(c.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mac: %v", err)
+	}
+	if subtle.ConstantTimeCompare(keccak256(derivedKey[16:32], cipherText), mac) != 1 {
+		return nil, fmt.Errorf("wrong password")
+	}
+
+	iv, err := hex.DecodeString(c.CipherParams.IV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iv: %v", err)
+	}
+	block, err := aes.NewCipher(derivedKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("invalid iv length %d", len(iv))
+	}
+	key := make([]byte, len(cipherText))
+	cipher.NewCTR(block, iv).XORKeyStream(key, cipherText)
+	return key, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"deploychain/models"
+
+	"dagger.io/dagger"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFiles are the accepted names of the project manifest, in order of preference
+var manifestFiles = []string{"deploychain.yaml", "deploychain.yml"}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ManifestError lists every problem found in a deploychain.yaml
+type ManifestError struct {
+	File     string
+	Problems []string
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.File, strings.Join(e.Problems, "; "))
+}
+
+// loadManifest reads and validates the manifest at the repository root.
+// It returns nil when the repository has none.
+func loadManifest(ctx context.Context, repo *dagger.Directory, networks *NetworkRegistry) (*models.Manifest, string, error) {
+	entries, err := repo.Entries(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		present[entry] = true
+	}
+
+	for _, name := range manifestFiles {
+		if !present[name] {
+			continue
+		}
+		contents, err := repo.File(name).Contents(ctx)
+		if err != nil {
+			return nil, name, err
+		}
+		manifest, err := ParseManifest(name, []byte(contents), networks)
+		return manifest, name, err
+	}
+	return nil, "", nil
+}
+
+// ParseManifest decodes a manifest, rejecting unknown fields, and validates it.
+// Networks must be configured in networks, whose default is used when none are listed.
+func ParseManifest(file string, data []byte, networks *NetworkRegistry) (*models.Manifest, error) {
+	var manifest models.Manifest
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		// Type errors carry one message per offending line, report each of them
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			problems := make([]string, len(typeErr.Errors))
+			for i, problem := range typeErr.Errors {
+				problems[i] = strings.TrimSpace(problem)
+			}
+			return nil, &ManifestError{File: file, Problems: problems}
+		}
+		return nil, &ManifestError{File: file, Problems: []string{strings.TrimPrefix(err.Error(), "yaml: ")}}
+	}
+
+	if manifest.Version == 0 {
+		manifest.Version = models.ManifestVersion
+	}
+	if manifest.Type == "" {
+		manifest.Type = models.TypeDApp
+	}
+	if len(manifest.Networks) == 0 {
+		manifest.Networks = []string{networks.Default()}
+	}
+
+	if problems := validateManifest(&manifest, networks); len(problems) > 0 {
+		return nil, &ManifestError{File: file, Problems: problems}
+	}
+	return &manifest, nil
+}
+
+// validateManifest checks a decoded manifest against the schema
+func validateManifest(m *models.Manifest, networks *NetworkRegistry) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if m.Version != models.ManifestVersion {
+		add("version: unsupported version %d (expected %d)", m.Version, models.ManifestVersion)
+	}
+
+	switch m.Type {
+	case models.TypeDApp:
+	case models.TypeStatic:
+		if m.Contracts.Path != "" || len(m.Contracts.Deploy) > 0 {
+			add("contracts: not allowed for type %q", models.TypeStatic)
+		}
+	default:
+		add("type: must be %q or %q, got %q", models.TypeDApp, models.TypeStatic, m.Type)
+	}
+
+	seenNetworks := make(map[string]bool)
+	for i, network := range m.Networks {
+		if _, ok := networks.Get(network); !ok {
+			add("networks[%d]: unknown network %q (expected one of %s)", i, network, strings.Join(networks.Names(), ", "))
+		} else if seenNetworks[network] {
+			add("networks[%d]: duplicate network %q", i, network)
+		}
+		seenNetworks[network] = true
+	}
+
+	problems = append(problems, validateEnv("env", m.Env)...)
+
+	if p := m.Contracts.Path; p != "" && !isRelativePath(p) {
+		add("contracts.path: must be a relative path inside the repository, got %q", p)
+	}
+	switch m.Contracts.Framework {
+	case "", models.FrameworkHardhat, models.FrameworkFoundry:
+	default:
+		add("contracts.framework: must be %q or %q, got %q",
+			models.FrameworkHardhat, models.FrameworkFoundry, m.Contracts.Framework)
+	}
+	problems = append(problems, validateEnv("contracts.env", m.Contracts.Env)...)
+	if m.Contracts.MaxFeeGwei < 0 {
+		add("contracts.max_fee_gwei: must not be negative, got %v", m.Contracts.MaxFeeGwei)
+	}
+
+	seenContracts := make(map[string]bool)
+	for i, target := range m.Contracts.Deploy {
+		switch {
+		case target.Name == "":
+			add("contracts.deploy[%d].name: required", i)
+		case seenContracts[target.Name]:
+			add("contracts.deploy[%d].name: duplicate contract %q", i, target.Name)
+		}
+		seenContracts[target.Name] = true
+	}
+	for i, target := range m.Contracts.Deploy {
+		for _, ref := range addressRefs(target.Args) {
+			if !seenContracts[ref] {
+				add("contracts.deploy[%d].args: ${%s.address} refers to a contract that is not deployed", i, ref)
+			}
+		}
+		for _, dep := range target.DependsOn {
+			if !seenContracts[dep] {
+				add("contracts.deploy[%d].depends_on: %q is not deployed", i, dep)
+			}
+		}
+	}
+
+	if p := m.Frontend.Path; p != "" && !isRelativePath(p) {
+		add("frontend.path: must be a relative path inside the repository, got %q", p)
+	}
+	if p := m.Frontend.Output; p != "" && !isRelativePath(p) {
+		add("frontend.output: must be a relative path inside the frontend, got %q", p)
+	}
+	problems = append(problems, validateEnv("frontend.env", m.Frontend.Env)...)
+
+	return problems
+}
+
+// validateEnv checks that environment variable names are valid shell identifiers
+func validateEnv(field string, env map[string]string) []string {
+	var problems []string
+	for name := range env {
+		if !envNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("%s: invalid variable name %q", field, name))
+		}
+	}
+	return problems
+}
+
+// isRelativePath reports whether p stays inside the directory it is relative to
+func isRelativePath(p string) bool {
+	if path.IsAbs(p) {
+		return false
+	}
+	cleaned := path.Clean(p)
+	return cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
+
+// applyManifest overrides the detected layout with the paths and build settings of the manifest
+func (ds *DaggerService) applyManifest(ctx context.Context, repo *dagger.Directory, layout *ProjectLayout, manifest *models.Manifest) error {
+	layout.Env = manifest.Env
+	layout.Contracts = manifest.Contracts.BuildSettings
+	layout.Frontend = manifest.Frontend.BuildSettings
+	layout.FrontendOutput = manifest.Frontend.Output
+
+	if manifest.Type == models.TypeStatic {
+		layout.Framework = ""
+		layout.ContractsPath = ""
+	} else if p := manifest.Contracts.Path; p != "" {
+		layout.ContractsPath = path.Clean(p)
+		layout.Framework = manifest.Contracts.Framework
+		if layout.Framework == "" {
+			framework, err := ds.detectWeb3Project(ctx, subdirectory(repo, layout.ContractsPath))
+			if err != nil {
+				return fmt.Errorf("contracts.path %s: %v", p, err)
+			}
+			if framework == "" {
+				return fmt.Errorf("contracts.path %s: no Hardhat or Foundry project found", p)
+			}
+			layout.Framework = framework
+		}
+	} else if manifest.Contracts.Framework != "" {
+		layout.Framework = manifest.Contracts.Framework
+		if layout.ContractsPath == "" {
+			layout.ContractsPath = "."
+		}
+	}
+
+	if p := manifest.Frontend.Path; p != "" {
+		layout.FrontendPath = path.Clean(p)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"deploychain/models"
+)
+
+// networkRun is the deployment of a build to one of its networks
+type networkRun struct {
+	network *models.Network
+	backend ChainBackend
+	record  models.DeploymentNetwork
+	// contracts are the contracts deployed to the network
+	contracts []models.ContractDeployment
+	// err is set once the network failed
+	err error
+}
+
+// forEachRun calls fn for every network concurrently and waits for all of them
+func forEachRun(runs []*networkRun, fn func(run *networkRun)) {
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *networkRun) {
+			defer wg.Done()
+			fn(run)
+		}(run)
+	}
+	wg.Wait()
+}
+
+// runsError combines the failures of every network, nil if none failed
+func runsError(runs []*networkRun) error {
+	var failures []string
+	for _, run := range runs {
+		if run.err != nil {
+			failures = append(failures, run.err.Error())
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failures, "; "))
+}
+
+// networkTracker records the status of each network and moves the deployment
+// to the least advanced status of the networks still in progress
+type networkTracker struct {
+	deployer     *Deployer
+	deploymentID int
+	runs         []*networkRun
+
+	mu     sync.Mutex
+	status string
+}
+
+// newNetworkTracker starts tracking networks that are about to be deployed to
+func newNetworkTracker(d *Deployer, deploymentID int, runs []*networkRun) *networkTracker {
+	t := &networkTracker{deployer: d, deploymentID: deploymentID, runs: runs}
+	for _, run := range runs {
+		t.set(run, models.StatusSubmitted)
+	}
+	return t
+}
+
+// set records the status of a network along with its current results
+func (t *networkTracker) set(run *networkRun, status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run.record.Status = status
+	if err := t.deployer.db.UpdateDeploymentNetwork(run.record); err != nil {
+		log.Printf("Failed to update %s deployment status: %v", run.network.Name, err)
+	}
+
+	overall := ""
+	for _, r := range t.runs {
+		switch r.record.Status {
+		case models.StatusPending, models.StatusSubmitted:
+			overall = models.StatusSubmitted
+		case models.StatusConfirming:
+			if overall == "" {
+				overall = models.StatusConfirming
+			}
+		}
+	}
+	// Final statuses are set once every network is done
+	if overall != "" && overall != t.status {
+		t.status = overall
+		t.deployer.setStatus(t.deploymentID, overall)
+	}
+}
+
+// fail records the failure of a network
+func (t *networkTracker) fail(run *networkRun, err error) {
+	run.err = fmt.Errorf("%s: %v", run.network.Name, err)
+	run.record.ErrorMessage = err.Error()
+	t.set(run, models.StatusFailed)
+}
+
+// deployNetwork deploys the planned contracts to the network of a run
+func (d *Deployer) deployNetwork(ctx context.Context, run *networkRun, plan []DeployTarget, maxFeeGwei float64, tracker *networkTracker, logger *BuildLogger) {
+	network := run.network
+	deployer, err := run.backend.DeployerAddress(ctx)
+	if err != nil {
+		logger.Error(models.StageDeploy, "[%s] No deployer account: %v", network.Name, err)
+		tracker.fail(run, err)
+		return
+	}
+	run.record.DeployerAddress = deployer
+	logger.Info(models.StageDeploy, "[%s] Deploying via %s from %s", network.Name, run.backend.Name(), deployer)
+
+	txs := d.txs.Session(run.record.DeploymentID, network.Name, maxFeeGwei, logger)
+	contracts, err := DeployContracts(ctx, run.backend, network, plan, txs)
+	run.contracts = contracts
+	run.record.ContractAddresses, run.record.TransactionHashes = summarizeContracts(contracts)
+	// Gas spent is recorded whatever the outcome
+	gasUsed, totalCostWei, recordErr := d.db.RecordContractDeployments(run.record.DeploymentID, network.Name, contracts)
+	if recordErr != nil {
+		log.Printf("Failed to record contract deployments on %s: %v", network.Name, recordErr)
+	} else {
+		run.record.GasUsed = gasUsed
+		run.record.TotalCostWei = totalCostWei
+	}
+	if ctx.Err() != nil {
+		// Transactions already sent cannot be recalled, keep a record of them
+		for name, address := range run.record.ContractAddresses {
+			logger.Warn(models.StageDeploy, "[%s] Deployed %s at %s before cancellation", network.Name, name, address)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Contract deployment to %s failed: %v", network.Name, err)
+		for name, address := range run.record.ContractAddresses {
+			logger.Warn(models.StageDeploy, "[%s] Deployed %s at %s before the failure", network.Name, name, address)
+		}
+		logger.Error(models.StageDeploy, "[%s] Contract deployment failed: %v", network.Name, err)
+		tracker.fail(run, err)
+		return
+	}
+
+	symbol := network.NativeCurrency.Symbol
+	for _, contract := range contracts {
+		logger.Info(models.StageDeploy, "[%s] Deployed %s at %s (gas used %d at %s wei, cost %s %s)",
+			network.Name, contract.Name, contract.Address, contract.GasUsed, contract.EffectiveGasPrice, contract.Cost, symbol)
+	}
+	logger.Info(models.StageDeploy, "[%s] Total gas used %d, total cost %s %s",
+		network.Name, run.record.GasUsed, FormatUnits(run.record.TotalCostWei, network.NativeCurrency.Decimals), symbol)
+	tracker.set(run, models.StatusSubmitted)
+}
+
+// confirmNetwork waits for the transactions of a run to reach the confirmation
+// depth of its network
+func (d *Deployer) confirmNetwork(ctx context.Context, run *networkRun, tracker *networkTracker, logger *BuildLogger) {
+	network := run.network
+	required := network.Confirmations
+	logger.Info(models.StageConfirm, "[%s] Waiting for %d confirmations of %d transactions",
+		network.Name, required, len(run.record.TransactionHashes))
+	err := d.confirmations.WaitForConfirmations(ctx, run.backend, run.record.TransactionHashes, required, logger, func(status string) {
+		tracker.set(run, status)
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("Confirmation on %s failed: %v", network.Name, err)
+		logger.Error(models.StageConfirm, "[%s] Confirmation failed: %v", network.Name, err)
+		tracker.fail(run, err)
+		return
+	}
+	logger.Info(models.StageConfirm, "[%s] Deployed", network.Name)
+	tracker.set(run, models.StatusDeployed)
+}
+
+// cancelRuns marks the networks still in progress cancelled
+func (d *Deployer) cancelRuns(runs []*networkRun, tracker *networkTracker, logger *BuildLogger, stage string) {
+	for _, run := range runs {
+		switch run.record.Status {
+		case models.StatusDeployed, models.StatusFailed:
+			continue
+		}
+		logger.Warn(stage, "[%s] Cancelled", run.network.Name)
+		tracker.set(run, models.StatusCancelled)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deploychain/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ether is the native currency of Ethereum and its testnets
+var ether = models.NativeCurrency{Name: "Ether", Symbol: "ETH", Decimals: 18}
+
+// etherscanAPI serves every chain Etherscan and Polygonscan index, selected
+// by the chainid parameter
+const etherscanAPI = "https://api.etherscan.io/v2/api"
+
+// builtinNetworks are available without configuration. MultiBaas names the
+// chain of a deployment "ethereum" whichever network it is connected to.
+var builtinNetworks = []models.Network{
+	{
+		Name:           "ethereum",
+		ChainID:        1,
+		MultiBaasChain: "ethereum",
+		ExplorerURL:    "https://etherscan.io",
+		VerifyAPIURL:   etherscanAPI,
+		NativeCurrency: ether,
+		Confirmations:  12,
+		Mainnet:        true,
+	},
+	{
+		Name:           "sepolia",
+		ChainID:        11155111,
+		MultiBaasChain: "ethereum",
+		ExplorerURL:    "https://sepolia.etherscan.io",
+		VerifyAPIURL:   etherscanAPI,
+		NativeCurrency: models.NativeCurrency{Name: "Sepolia Ether", Symbol: "ETH", Decimals: 18},
+		Confirmations:  3,
+	},
+	{
+		Name:           "holesky",
+		ChainID:        17000,
+		MultiBaasChain: "ethereum",
+		ExplorerURL:    "https://holesky.etherscan.io",
+		VerifyAPIURL:   etherscanAPI,
+		NativeCurrency: models.NativeCurrency{Name: "Holesky Ether", Symbol: "ETH", Decimals: 18},
+		Confirmations:  3,
+	},
+	{
+		Name:           "polygon",
+		ChainID:        137,
+		MultiBaasChain: "ethereum",
+		ExplorerURL:    "https://polygonscan.com",
+		VerifyAPIURL:   etherscanAPI,
+		NativeCurrency: models.NativeCurrency{Name: "POL", Symbol: "POL", Decimals: 18},
+		Confirmations:  64,
+		Mainnet:        true,
+	},
+	{
+		Name:           "amoy",
+		ChainID:        80002,
+		MultiBaasChain: "ethereum",
+		ExplorerURL:    "https://amoy.polygonscan.com",
+		VerifyAPIURL:   etherscanAPI,
+		NativeCurrency: models.NativeCurrency{Name: "POL", Symbol: "POL", Decimals: 18},
+		Confirmations:  5,
+	},
+}
+
+// defaultNetwork is deployed to when a project does not name a network
+const defaultNetwork = "sepolia"
+
+// networksFile is the format of NETWORKS_FILE
+type networksFile struct {
+	Default  string               `yaml:"default"`
+	Networks map[string]yaml.Node `yaml:"networks"`
+}
+
+// NetworkRegistry holds the networks deployments can target
+type NetworkRegistry struct {
+	networks       map[string]*models.Network
+	defaultNetwork string
+}
+
+// LoadNetworkRegistry starts from the built-in networks and applies NETWORKS_FILE,
+// which adds networks or overrides fields of built-in ones, then the per-network
+// environment variables RPC_URL_<NETWORK>, CONFIRMATIONS_<NETWORK>,
+// VERIFY_API_URL_<NETWORK> and VERIFY_API_KEY_<NETWORK>. VERIFY_API_KEY is the
+// verification API key of networks without their own.
+// DEFAULT_NETWORK overrides the default network.
+func LoadNetworkRegistry() (*NetworkRegistry, error) {
+	r := &NetworkRegistry{
+		networks:       make(map[string]*models.Network),
+		defaultNetwork: defaultNetwork,
+	}
+	for _, network := range builtinNetworks {
+		n := network
+		r.networks[n.Name] = &n
+	}
+
+	if path := os.Getenv("NETWORKS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read networks file: %v", err)
+		}
+		if err := r.apply(data); err != nil {
+			return nil, fmt.Errorf("invalid networks file %s: %v", path, err)
+		}
+	}
+
+	// Networks only configured through the environment
+	for _, name := range rpcNetworks() {
+		if _, ok := r.networks[name]; !ok {
+			r.networks[name] = &models.Network{Name: name, NativeCurrency: ether}
+		}
+	}
+	for name, network := range r.networks {
+		if url := os.Getenv(networkEnv("RPC_URL_", name)); url != "" {
+			network.RPCURL = url
+		}
+		if url := os.Getenv(networkEnv("VERIFY_API_URL_", name)); url != "" {
+			network.VerifyAPIURL = url
+		}
+		if key := os.Getenv(networkEnv("VERIFY_API_KEY_", name)); key != "" {
+			network.VerifyAPIKey = key
+		} else if network.VerifyAPIKey == "" {
+			network.VerifyAPIKey = os.Getenv("VERIFY_API_KEY")
+		}
+		env := networkEnv("CONFIRMATIONS_", name)
+		if value := os.Getenv(env); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s=%q", env, value)
+			}
+			network.Confirmations = n
+		}
+	}
+
+	if name := os.Getenv("DEFAULT_NETWORK"); name != "" {
+		r.defaultNetwork = name
+	}
+	if _, ok := r.networks[r.defaultNetwork]; !ok {
+		return nil, fmt.Errorf("default network %q is not configured", r.defaultNetwork)
+	}
+
+	for _, network := range r.networks {
+		if network.RPCURL == "" && network.MultiBaasChain == "" {
+			return nil, fmt.Errorf("network %s needs rpc_url or multibaas_chain", network.Name)
+		}
+		if network.Confirmations < 1 {
+			network.Confirmations = 1
+		}
+		if network.NativeCurrency.Symbol == "" {
+			network.NativeCurrency = ether
+		}
+		if network.NativeCurrency.Decimals == 0 {
+			network.NativeCurrency.Decimals = 18
+		}
+		// Etherscan rejects every request without an API key
+		if network.VerifyAPIURL == etherscanAPI && network.VerifyAPIKey == "" {
+			network.VerifyAPIURL = ""
+		}
+	}
+	return r, nil
+}
+
+// apply adds the networks of a networks file to the registry
+func (r *NetworkRegistry) apply(data []byte) error {
+	var file networksFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	for name, node := range file.Networks {
+		if strings.ToLower(name) != name {
+			return fmt.Errorf("network name %q must be lowercase", name)
+		}
+		network, ok := r.networks[name]
+		if !ok {
+			network = &models.Network{Name: name}
+			r.networks[name] = network
+		}
+		// Decoding into the existing network only replaces the fields present
+		if err := node.Decode(network); err != nil {
+			return fmt.Errorf("network %s: %v", name, err)
+		}
+		network.Name = name
+	}
+	if file.Default != "" {
+		r.defaultNetwork = file.Default
+	}
+	return nil
+}
+
+// Get returns a configured network by name
+func (r *NetworkRegistry) Get(name string) (*models.Network, bool) {
+	network, ok := r.networks[name]
+	return network, ok
+}
+
+// Default returns the name of the network used when a project names none
+func (r *NetworkRegistry) Default() string {
+	return r.defaultNetwork
+}
+
+// List returns every configured network sorted by name
+func (r *NetworkRegistry) List() []models.Network {
+	networks := make([]models.Network, 0, len(r.networks))
+	for _, network := range r.networks {
+		networks = append(networks, *network)
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	return networks
+}
+
+// Names returns the names of every configured network, sorted
+func (r *NetworkRegistry) Names() []string {
+	names := make([]string, 0, len(r.networks))
+	for name := range r.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NonceManager allocates the nonces of deployer accounts, so concurrent
+// deployments from the same account on the same chain never send two
+// transactions with one nonce. The next nonce of each account is kept in
+// Postgres, where a row lock serializes allocation across replicas.
+type NonceManager struct {
+	store nonceStore
+
+	mu       sync.Mutex
+	accounts map[string]*nonceAccount
+}
+
+// nonceStore keeps the next nonce of each account, *Database outside of tests
+type nonceStore interface {
+	AllocateNonce(chainID int64, address string, pending uint64, resync bool) (uint64, error)
+	ReleaseNonce(chainID int64, address string, nonce uint64) error
+}
+
+// nonceAccount serializes allocation for one account within this process
+type nonceAccount struct {
+	mu sync.Mutex
+	// inFlight counts the leases handed out but not yet committed or released
+	inFlight int
+}
+
+// NonceLease is a nonce reserved for one transaction. It is committed once the
+// transaction is submitted, or released for reuse if submission failed.
+type NonceLease struct {
+	Nonce uint64
+
+	manager *NonceManager
+	account *nonceAccount
+	chainID int64
+	address string
+	done    bool
+}
+
+// NewNonceManager creates a nonce manager storing its state in db
+func NewNonceManager(db *Database) *NonceManager {
+	return &NonceManager{store: db, accounts: make(map[string]*nonceAccount)}
+}
+
+// nonceGapTimeout is how long an account must go without allocating a nonce
+// before nonces the chain has not seen are considered lost
+func nonceGapTimeout() time.Duration {
+	return receiptTimeout()
+}
+
+func (m *NonceManager) account(chainID int64, address string) *nonceAccount {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%d/%s", chainID, address)
+	account, ok := m.accounts[key]
+	if !ok {
+		account = &nonceAccount{}
+		m.accounts[key] = account
+	}
+	return account
+}
+
+// Acquire reserves a nonce for the next transaction of address on a chain.
+// pending is the account's pending transaction count as reported by the chain,
+// which moves the next nonce forward past transactions sent by other tools.
+func (m *NonceManager) Acquire(chainID int64, address string, pending uint64) (*NonceLease, error) {
+	address = strings.ToLower(address)
+	account := m.account(chainID, address)
+	account.mu.Lock()
+	defer account.mu.Unlock()
+
+	// Only resync to a lower nonce when no transaction of ours is about to be sent
+	nonce, err := m.store.AllocateNonce(chainID, address, pending, account.inFlight == 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate nonce: %v", err)
+	}
+	account.inFlight++
+	return &NonceLease{Nonce: nonce, manager: m, account: account, chainID: chainID, address: address}, nil
+}
+
+// Commit records that the transaction using the nonce was submitted
+func (l *NonceLease) Commit() {
+	l.finish()
+}
+
+// Release returns the nonce of a transaction that could not be submitted, so
+// the next transaction of the account fills the gap
+func (l *NonceLease) Release() {
+	if !l.finish() {
+		return
+	}
+	if err := l.manager.store.ReleaseNonce(l.chainID, l.address, l.Nonce); err != nil {
+		log.Printf("Failed to release nonce %d of %s on chain %d: %v", l.Nonce, l.address, l.chainID, err)
+	}
+}
+
+// finish ends the lease, reporting false if it had already ended
+func (l *NonceLease) finish() bool {
+	l.account.mu.Lock()
+	defer l.account.mu.Unlock()
+	if l.done {
+		return false
+	}
+	l.done = true
+	l.account.inFlight--
+	return true
+}
+
+// AllocateNonce hands out the lowest released nonce of an account, or else
+// its next nonce. Released nonces the chain has already seen are discarded.
+// With resync, nonces the chain never saw are reallocated once the account has
+// been idle for nonceGapTimeout, as their transactions were dropped.
+func (d *Database) AllocateNonce(chainID int64, address string, pending uint64, resync bool) (uint64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO deployer_nonces (chain_id, address, next_nonce)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chain_id, address) DO NOTHING`,
+		chainID, address, int64(pending),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var next int64
+	var releasedJSON []byte
+	var updatedAt time.Time
+	err = tx.QueryRow(`
+		SELECT next_nonce, released, updated_at
+		FROM deployer_nonces
+		WHERE chain_id = $1 AND address = $2
+		FOR UPDATE`,
+		chainID, address,
+	).Scan(&next, &releasedJSON, &updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	var released []uint64
+	if err := json.Unmarshal(releasedJSON, &released); err != nil {
+		return 0, err
+	}
+
+	state := uint64(next)
+	var reusable []uint64
+	for _, nonce := range released {
+		if nonce >= pending && nonce < state {
+			reusable = append(reusable, nonce)
+		}
+	}
+	switch {
+	case state < pending:
+		// Transactions were sent from the account without us
+		state = pending
+	case state > pending && resync && len(reusable) == 0 && time.Since(updatedAt) > nonceGapTimeout():
+		log.Printf("Nonces %d to %d of %s on chain %d never reached the chain, reallocating them",
+			pending, state-1, address, chainID)
+		state = pending
+	}
+
+	var nonce uint64
+	if len(reusable) > 0 {
+		nonce, reusable = reusable[0], reusable[1:]
+	} else {
+		nonce = state
+		state++
+	}
+
+	if reusable == nil {
+		reusable = []uint64{}
+	}
+	releasedJSON, err = json.Marshal(reusable)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+		UPDATE deployer_nonces SET
+			next_nonce = $1,
+			released = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE chain_id = $3 AND address = $4`,
+		int64(state), releasedJSON, chainID, address,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return nonce, tx.Commit()
+}
+
+// ReleaseNonce returns a nonce that was allocated but never used. The last
+// allocated nonce lowers the next nonce, others are kept for reuse.
+func (d *Database) ReleaseNonce(chainID int64, address string, nonce uint64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var next int64
+	var releasedJSON []byte
+	err = tx.QueryRow(`
+		SELECT next_nonce, released
+		FROM deployer_nonces
+		WHERE chain_id = $1 AND address = $2
+		FOR UPDATE`,
+		chainID, address,
+	).Scan(&next, &releasedJSON)
+	if err != nil {
+		return err
+	}
+	var released []uint64
+	if err := json.Unmarshal(releasedJSON, &released); err != nil {
+		return err
+	}
+
+	state := uint64(next)
+	if nonce >= state {
+		return nil
+	}
+	released = append(released, nonce)
+	sort.Slice(released, func(i, j int) bool { return released[i] < released[j] })
+	// Released nonces at the end of the sequence are handed out again in order
+	for len(released) > 0 && released[len(released)-1] == state-1 {
+		released = released[:len(released)-1]
+		state--
+	}
+
+	if released == nil {
+		released = []uint64{}
+	}
+	releasedJSON, err = json.Marshal(released)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE deployer_nonces SET
+			next_nonce = $1,
+			released = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE chain_id = $3 AND address = $4`,
+		int64(state), releasedJSON, chainID, address,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"deploychain/models"
+)
+
+// Replacements raise fees by speedUpBump percent. Nodes reject replacements
+// raising the fee cap or tip by less than replacementMinBump percent.
+const (
+	speedUpBump        = 25
+	replacementMinBump = 10
+)
+
+// cancelGas is the gas of a plain transfer, which cancels a transaction by
+// taking its nonce
+const cancelGas = 21000
+
+// ErrNotReplaceable is returned when replacing a transaction that was not
+// signed locally, or whose fees cannot be raised under the maximum fee
+var ErrNotReplaceable = errors.New("transaction cannot be replaced")
+
+// ErrTxNotPending is returned when replacing a transaction that was mined
+var ErrTxNotPending = errors.New("transaction is no longer pending")
+
+// TxManager records the transactions deployments send and replaces stuck ones
+type TxManager struct {
+	db *Database
+	// speedUpAfter is how long a transaction may stay pending before it is
+	// replaced with higher fees, 0 to never speed up
+	speedUpAfter time.Duration
+	// maxFeePerGas caps the fees of replacements when the project sets no
+	// maximum, nil for no cap
+	maxFeePerGas *big.Int
+}
+
+// NewTxManager creates a transaction manager configured from the environment
+func NewTxManager(db *Database) *TxManager {
+	m := &TxManager{
+		db:           db,
+		speedUpAfter: time.Duration(envInt("SPEEDUP_AFTER_SECONDS", 120)) * time.Second,
+	}
+	if value := os.Getenv("MAX_FEE_GWEI"); value != "" {
+		gwei, err := strconv.ParseFloat(value, 64)
+		if err != nil || gwei <= 0 {
+			log.Printf("Ignoring invalid MAX_FEE_GWEI=%q", value)
+		} else {
+			m.maxFeePerGas = gweiToWei(gwei)
+		}
+	}
+	return m
+}
+
+// gweiToWei converts an amount of gwei to wei
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
+
+// TxSession records the transactions one deployment sends to one network and
+// speeds up those that get stuck
+type TxSession struct {
+	manager      *TxManager
+	deploymentID int
+	network      string
+	maxFeePerGas *big.Int
+	logger       *BuildLogger
+}
+
+// Session starts recording the transactions of a deployment on a network.
+// maxFeeGwei caps the fees of replacements, 0 for the server default.
+func (m *TxManager) Session(deploymentID int, network string, maxFeeGwei float64, logger *BuildLogger) *TxSession {
+	maxFee := m.maxFeePerGas
+	if maxFeeGwei > 0 {
+		maxFee = gweiToWei(maxFeeGwei)
+	}
+	return &TxSession{
+		manager:      m,
+		deploymentID: deploymentID,
+		network:      network,
+		maxFeePerGas: maxFee,
+		logger:       logger,
+	}
+}
+
+// Sent records the creation transaction of a contract
+func (s *TxSession) Sent(contract string, tx *SubmittedTx) error {
+	record := models.DeploymentTransaction{
+		DeploymentID: s.deploymentID,
+		Network:      s.network,
+		ContractName: contract,
+		OriginalHash: tx.Hash,
+		Kind:         models.TxKindDeploy,
+		From:         tx.From,
+	}
+	if s.maxFeePerGas != nil {
+		record.MaxFeePerGas = s.maxFeePerGas.String()
+	}
+	if tx.Tx == nil {
+		record.Hash = tx.Hash
+		record.Status = models.TxStatusPending
+		return s.manager.db.InsertDeploymentTransaction(record)
+	}
+	record, err := transactionRecord(record, tx.Hash, tx.Tx)
+	if err != nil {
+		return err
+	}
+	return s.manager.db.InsertDeploymentTransaction(record)
+}
+
+// Progress records the state of a contract's deployment before and after its
+// creation transaction is sent, so a resumed job does not send it again
+func (s *TxSession) Progress(contract models.ContractDeployment) error {
+	return s.manager.db.RecordContractProgress(s.deploymentID, contract)
+}
+
+// Resume returns the contracts an earlier attempt of the deployment sent to
+// the network, by name
+func (s *TxSession) Resume() (map[string]models.ContractDeployment, error) {
+	contracts, err := s.manager.db.GetContractDeployments(s.deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	earlier := make(map[string]models.ContractDeployment)
+	for _, contract := range contracts {
+		if contract.Network == s.network {
+			earlier[contract.Name] = contract
+		}
+	}
+	return earlier, nil
+}
+
+// WaitForReceipt polls until the transaction or one of its replacements is
+// mined and returns the receipt. A transaction pending for longer than the
+// speed-up timeout is replaced with higher fees, and fails once no
+// replacement was mined within the receipt timeout of the last one sent.
+func (s *TxSession) WaitForReceipt(ctx context.Context, backend ChainBackend, hash string) (*Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+
+	lastSent := time.Now()
+	speedUp := s.manager.speedUpAfter > 0
+	for {
+		history, err := s.manager.db.GetTransactionReplacements(hash)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+		if len(history) == 0 {
+			history = []models.DeploymentTransaction{{Hash: hash, OriginalHash: hash, Kind: models.TxKindDeploy}}
+		}
+
+		// The newest replacement is the most likely to be mined
+		for i := len(history) - 1; i >= 0; i-- {
+			tx := history[i]
+			receipt, err := backend.GetTransactionReceipt(ctx, tx.Hash)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return nil, err
+			}
+			if receipt == nil {
+				continue
+			}
+			if err := s.manager.db.MarkTransactionMined(hash, tx.Hash); err != nil {
+				log.Printf("Failed to record mined transaction %s: %v", tx.Hash, err)
+			}
+			if tx.Kind == models.TxKindCancel {
+				return nil, fmt.Errorf("transaction %s was cancelled by %s", hash, tx.Hash)
+			}
+			if tx.Hash != hash {
+				s.logger.Info(models.StageDeploy, "Transaction %s was replaced by %s", hash, tx.Hash)
+			}
+			return receipt, nil
+		}
+
+		latest := history[len(history)-1]
+		// Replacements sent through the API restart the clock
+		if latest.CreatedAt.After(lastSent) {
+			lastSent = latest.CreatedAt
+		}
+		if speedUp && latest.Kind != models.TxKindCancel && time.Since(lastSent) > s.manager.speedUpAfter {
+			replacement, err := s.manager.Replace(ctx, backend, latest, models.TxKindSpeedUp)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, fmt.Errorf("no receipt for transaction %s: %w", hash, ctx.Err())
+				}
+				s.logger.Warn(models.StageDeploy, "Cannot speed up transaction %s: %v", latest.Hash, err)
+				speedUp = false
+			} else {
+				s.logger.Warn(models.StageDeploy, "Transaction %s pending for %s, sped up by %s", latest.Hash,
+					time.Since(lastSent).Round(time.Second), replacement.Hash)
+				lastSent = time.Now()
+			}
+		}
+		if time.Since(lastSent) > receiptTimeout() {
+			return nil, fmt.Errorf("no receipt for transaction %s after %s", latest.Hash, receiptTimeout())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no receipt for transaction %s: %w", hash, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replace sends a replacement of a pending transaction with the same nonce and
+// higher fees. A speed-up resends the transaction, a cancellation sends nothing
+// to the sender's own address instead. Cancellations stay cancellations when
+// sped up.
+func (m *TxManager) Replace(ctx context.Context, backend ChainBackend, tx models.DeploymentTransaction, kind string) (*models.DeploymentTransaction, error) {
+	if tx.Status != models.TxStatusPending {
+		return nil, ErrTxNotPending
+	}
+	if len(tx.Params) == 0 {
+		return nil, fmt.Errorf("%w: it was not signed locally", ErrNotReplaceable)
+	}
+	var params UnsignedTx
+	if err := json.Unmarshal(tx.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid transaction parameters: %v", err)
+	}
+
+	var maxFee *big.Int
+	if tx.MaxFeePerGas != "" {
+		maxFee, _ = parseAmount(tx.MaxFeePerGas)
+	}
+	replacement, err := bumpFees(&params, maxFee)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotReplaceable, err)
+	}
+	if tx.Kind == models.TxKindCancel {
+		kind = models.TxKindCancel
+	}
+	if kind == models.TxKindCancel {
+		to, err := hex.DecodeString(strings.TrimPrefix(tx.From, "0x"))
+		if err != nil || len(to) != 20 {
+			return nil, fmt.Errorf("invalid sender address %q", tx.From)
+		}
+		replacement.To = to
+		replacement.Value = nil
+		replacement.Data = nil
+		replacement.Gas = cancelGas
+	}
+
+	hash, err := backend.SendTransaction(ctx, replacement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send replacement: %w", err)
+	}
+
+	record := tx
+	record.Replaces = tx.Hash
+	record.Kind = kind
+	record, err = transactionRecord(record, hash, replacement)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.db.InsertDeploymentTransaction(record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// transactionRecord fills in a pending transaction record from the transaction as signed
+func transactionRecord(record models.DeploymentTransaction, hash string, tx *UnsignedTx) (models.DeploymentTransaction, error) {
+	params, err := json.Marshal(tx)
+	if err != nil {
+		return record, err
+	}
+	record.Hash = hash
+	record.Status = models.TxStatusPending
+	record.Nonce = int64(tx.Nonce)
+	record.Params = params
+	record.GasPrice, record.GasFeeCap, record.GasTipCap = "", "", ""
+	if tx.Type == TxTypeDynamicFee {
+		record.GasFeeCap = tx.GasFeeCap.String()
+		record.GasTipCap = tx.GasTipCap.String()
+	} else {
+		record.GasPrice = tx.GasPrice.String()
+	}
+	record.CreatedAt = time.Now()
+	return record, nil
+}
+
+// bumpFees returns a copy of tx with its fees raised by speedUpBump percent,
+// the fee cap limited to maxFeePerGas. It fails when the limit leaves less
+// than the increase nodes require of a replacement.
+func bumpFees(tx *UnsignedTx, maxFeePerGas *big.Int) (*UnsignedTx, error) {
+	bumped := *tx
+	var err error
+	if tx.Type == TxTypeDynamicFee {
+		if bumped.GasFeeCap, err = raiseFee("max fee per gas", tx.GasFeeCap, maxFeePerGas); err != nil {
+			return nil, err
+		}
+		if bumped.GasTipCap, err = raiseFee("priority fee", tx.GasTipCap, bumped.GasFeeCap); err != nil {
+			return nil, err
+		}
+		return &bumped, nil
+	}
+	if bumped.GasPrice, err = raiseFee("gas price", tx.GasPrice, maxFeePerGas); err != nil {
+		return nil, err
+	}
+	return &bumped, nil
+}
+
+// raiseFee raises a fee by speedUpBump percent without exceeding limit, nil
+// for no limit
+func raiseFee(name string, fee, limit *big.Int) (*big.Int, error) {
+	if fee == nil {
+		return nil, fmt.Errorf("transaction has no %s", name)
+	}
+	raised := percentOf(fee, 100+speedUpBump)
+	if limit != nil && raised.Cmp(limit) > 0 {
+		raised = new(big.Int).Set(limit)
+	}
+	if raised.Cmp(percentOf(fee, 100+replacementMinBump)) < 0 {
+		return nil, fmt.Errorf("%s of %s wei cannot be raised by %d%% without exceeding %s wei",
+			name, fee, replacementMinBump, limit)
+	}
+	return raised, nil
+}
+
+// percentOf returns pct percent of n, rounded up so small fees still increase
+func percentOf(n *big.Int, pct int64) *big.Int {
+	result := new(big.Int).Mul(n, big.NewInt(pct))
+	result.Add(result, big.NewInt(99))
+	return result.Div(result, big.NewInt(100))
+}
+
+// deploymentTransactionColumns lists the columns read by scanDeploymentTransaction, in order
+const deploymentTransactionColumns = `id, deployment_id, network, contract_name, hash, original_hash,
+	replaces, kind, status, from_address, nonce, gas_price, gas_fee_cap, gas_tip_cap,
+	max_fee_per_gas, params, created_at, updated_at`
+
+// scanDeploymentTransaction reads a row selected with deploymentTransactionColumns
+func scanDeploymentTransaction(row rowScanner) (models.DeploymentTransaction, error) {
+	var tx models.DeploymentTransaction
+	var params []byte
+	err := row.Scan(
+		&tx.ID, &tx.DeploymentID, &tx.Network, &tx.ContractName, &tx.Hash, &tx.OriginalHash,
+		&tx.Replaces, &tx.Kind, &tx.Status, &tx.From, &tx.Nonce, &tx.GasPrice, &tx.GasFeeCap,
+		&tx.GasTipCap, &tx.MaxFeePerGas, &params, &tx.CreatedAt, &tx.UpdatedAt,
+	)
+	tx.Params = params
+	return tx, err
+}
+
+// InsertDeploymentTransaction records a transaction sent by a deployment
+func (d *Database) InsertDeploymentTransaction(tx models.DeploymentTransaction) error {
+	var params interface{}
+	if len(tx.Params) > 0 {
+		params = []byte(tx.Params)
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO deployment_transactions (
+			deployment_id, network, contract_name, hash, original_hash, replaces, kind,
+			status, from_address, nonce, gas_price, gas_fee_cap, gas_tip_cap,
+			max_fee_per_gas, params
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		tx.DeploymentID, tx.Network, tx.ContractName, tx.Hash, tx.OriginalHash, tx.Replaces,
+		tx.Kind, tx.Status, tx.From, tx.Nonce, tx.GasPrice, tx.GasFeeCap, tx.GasTipCap,
+		tx.MaxFeePerGas, params,
+	)
+	return err
+}
+
+// GetDeploymentTransactions retrieves the transaction history of a deployment, oldest first
+func (d *Database) GetDeploymentTransactions(deploymentID int) ([]models.DeploymentTransaction, error) {
+	return d.queryDeploymentTransactions(`
+		SELECT `+deploymentTransactionColumns+`
+		FROM deployment_transactions WHERE deployment_id = $1 ORDER BY id`,
+		deploymentID,
+	)
+}
+
+// GetTransactionReplacements retrieves a transaction and its replacements, oldest first
+func (d *Database) GetTransactionReplacements(originalHash string) ([]models.DeploymentTransaction, error) {
+	return d.queryDeploymentTransactions(`
+		SELECT `+deploymentTransactionColumns+`
+		FROM deployment_transactions WHERE original_hash = $1 ORDER BY id`,
+		originalHash,
+	)
+}
+
+// GetDeploymentTransaction retrieves a transaction of a deployment by hash
+func (d *Database) GetDeploymentTransaction(deploymentID int, hash string) (models.DeploymentTransaction, error) {
+	return scanDeploymentTransaction(d.db.QueryRow(`
+		SELECT `+deploymentTransactionColumns+`
+		FROM deployment_transactions WHERE deployment_id = $1 AND hash = $2`,
+		deploymentID, hash,
+	))
+}
+
+func (d *Database) queryDeploymentTransactions(query string, args ...interface{}) ([]models.DeploymentTransaction, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := []models.DeploymentTransaction{}
+	for rows.Next() {
+		tx, err := scanDeploymentTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
+
+// MarkTransactionMined records which transaction with a nonce was mined, the
+// others being replaced
+func (d *Database) MarkTransactionMined(originalHash, minedHash string) error {
+	_, err := d.db.Exec(`
+		UPDATE deployment_transactions SET
+			status = CASE WHEN hash = $2 THEN $3 ELSE $4 END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE original_hash = $1`,
+		originalHash, minedHash, models.TxStatusMined, models.TxStatusReplaced,
+	)
+	return err
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"math/big"
+)
+
+// rlpList is an RLP list, items are []byte, *big.Int, uint64 or nested rlpLists
+type rlpList []interface{}
+
+// rlpEncode serializes a value with Ethereum's recursive length prefix encoding
+func rlpEncode(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 1 && v[0] < 0x80 {
+			return []byte{v[0]}
+		}
+		return append(rlpHeader(0x80, len(v)), v...)
+	case uint64:
+		return rlpEncode(new(big.Int).SetUint64(v))
+	case *big.Int:
+		// Integers are big-endian with no leading zeros, zero is the empty string
+		if v == nil {
+			return rlpEncode([]byte{})
+		}
+		return rlpEncode(v.Bytes())
+	case rlpList:
+		var payload []byte
+		for _, item := range v {
+			payload = append(payload, rlpEncode(item)...)
+		}
+		return append(rlpHeader(0xc0, len(payload)), payload...)
+	default:
+		panic("rlp: unsupported type")
+	}
+}
+
+// rlpHeader returns the prefix of a string (offset 0x80) or list (offset 0xc0) of size bytes
+func rlpHeader(offset byte, size int) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	sizeBytes := new(big.Int).SetInt64(int64(size)).Bytes()
+	return append([]byte{offset + 55 + byte(len(sizeBytes))}, sizeBytes...)
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// Transaction types
+const (
+	TxTypeLegacy     = 0
+	TxTypeDynamicFee = 2
+)
+
+// UnsignedTx is a transaction ready to be signed. To is nil for contract creation.
+type UnsignedTx struct {
+	Type      int
+	ChainID   *big.Int
+	Nonce     uint64
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+	Gas       uint64
+	To        []byte
+	Value     *big.Int
+	Data      []byte
+}
+
+// Signer signs transactions on behalf of a single account
+type Signer interface {
+	// Address returns the EIP-55 checksummed address of the account
+	Address() string
+	// SignTransaction returns the raw signed transaction and its hash
+	SignTransaction(tx *UnsignedTx) ([]byte, string, error)
+}
+
+// KeySigner signs with a secp256k1 private key held in memory
+type KeySigner struct {
+	key     *secp256k1.PrivateKey
+	address string
+}
+
+// NewKeySigner creates a signer from a 32 byte private key
+func NewKeySigner(privateKey []byte) (*KeySigner, error) {
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("private key must be 32 bytes, got %d", len(privateKey))
+	}
+	key := secp256k1.PrivKeyFromBytes(privateKey)
+	if key.Key.IsZero() {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return &KeySigner{key: key, address: publicKeyAddress(key.PubKey())}, nil
+}
+
+// NewSignerFromEnv loads the keystore named by SIGNER_KEYSTORE, unlocked with
+// SIGNER_PASSWORD_FILE or SIGNER_PASSWORD. It returns nil when no keystore is
+// configured, leaving signing to MultiBaas.
+func NewSignerFromEnv() (Signer, error) {
+	path := os.Getenv("SIGNER_KEYSTORE")
+	if path == "" {
+		return nil, nil
+	}
+
+	password := os.Getenv("SIGNER_PASSWORD")
+	if passwordFile := os.Getenv("SIGNER_PASSWORD_FILE"); passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signer password: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	signer, err := NewKeystoreSigner(path, password)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// Address returns the EIP-55 checksummed address of the key
+func (s *KeySigner) Address() string {
+	return s.address
+}
+
+// SignTransaction signs a legacy (EIP-155) or dynamic fee (EIP-1559) transaction
+func (s *KeySigner) SignTransaction(tx *UnsignedTx) ([]byte, string, error) {
+	if tx.ChainID == nil || tx.ChainID.Sign() <= 0 {
+		return nil, "", fmt.Errorf("transaction has no chain ID")
+	}
+
+	var to interface{} = []byte{}
+	if tx.To != nil {
+		to = tx.To
+	}
+
+	switch tx.Type {
+	case TxTypeLegacy:
+		fields := rlpList{tx.Nonce, tx.GasPrice, tx.Gas, to, tx.Value, tx.Data}
+		sigHash := keccak256(rlpEncode(append(fields, tx.ChainID, uint64(0), uint64(0))))
+		recovery, r, sig := s.sign(sigHash)
+
+		// EIP-155: v = recovery id + chain ID * 2 + 35
+		v := new(big.Int).Mul(tx.ChainID, big.NewInt(2))
+		v.Add(v, big.NewInt(int64(recovery)+35))
+		raw := rlpEncode(append(fields, v, r, sig))
+		return raw, "0x" + hex.EncodeToString(keccak256(raw)), nil
+
+	case TxTypeDynamicFee:
+		fields := rlpList{tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.Gas, to, tx.Value, tx.Data, rlpList{}}
+		sigHash := keccak256(append([]byte{TxTypeDynamicFee}, rlpEncode(fields)...))
+		recovery, r, sig := s.sign(sigHash)
+
+		raw := append([]byte{TxTypeDynamicFee}, rlpEncode(append(fields, uint64(recovery), r, sig))...)
+		return raw, "0x" + hex.EncodeToString(keccak256(raw)), nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported transaction type %d", tx.Type)
+	}
+}
+
+// sign returns the recovery id and the r and s values of a signature over hash
+func (s *KeySigner) sign(hash []byte) (byte, *big.Int, *big.Int) {
+	// Compact signatures are [27 + recovery id, r, s]
+	sig := ecdsa.SignCompact(s.key, hash, false)
+	r := new(big.Int).SetBytes(sig[1:33])
+	sv := new(big.Int).SetBytes(sig[33:65])
+	return sig[0] - 27, r, sv
+}
+
+// publicKeyAddress derives the Ethereum address of a public key
+func publicKeyAddress(pub *secp256k1.PublicKey) string {
+	hash := keccak256(pub.SerializeUncompressed()[1:])
+	return checksumAddress(hash[12:])
+}
+
+// checksumAddress formats a 20 byte address with the EIP-55 mixed-case checksum
+func checksumAddress(address []byte) string {
+	lower := hex.EncodeToString(address)
+	hash := hex.EncodeToString(keccak256([]byte(lower)))
+
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && hash[i] >= '8' {
+			out[i] = c - ('a' - 'A')
+		}
+	}
+	return "0x" + string(out)
+}
+
+// keccak256 hashes data with the Keccak variant used by Ethereum
+func keccak256(data ...[]byte) []byte {
+	hasher := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1_000_000_000))
+}
+
+func etherWei(n int64) *big.Int {
+	return new(big.Int).Mul(gwei(n), big.NewInt(1_000_000_000))
+}
+
+// eip155Key is the private key of the example transaction in EIP-155
+const eip155Key = "4646464646464646464646464646464646464646464646464646464646464646"
+
+func TestSignLegacyTransaction(t *testing.T) {
+	signer, err := NewKeySigner(mustHex(t, eip155Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := signer.Address(), "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F"; got != want {
+		t.Errorf("address = %s, want %s", got, want)
+	}
+
+	raw, hash, err := signer.SignTransaction(&UnsignedTx{
+		Type:     TxTypeLegacy,
+		ChainID:  big.NewInt(1),
+		Nonce:    9,
+		GasPrice: gwei(20),
+		Gas:      21000,
+		To:       mustHex(t, "3535353535353535353535353535353535353535"),
+		Value:    etherWei(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signed transaction published in EIP-155
+	want := "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a7640000" +
+		"8025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276" +
+		"a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if got := hex.EncodeToString(raw); got != want {
+		t.Errorf("signed transaction =\n%s\nwant\n%s", got, want)
+	}
+	if want := "0x" + hex.EncodeToString(keccak256(mustHex(t, want))); hash != want {
+		t.Errorf("hash = %s, want %s", hash, want)
+	}
+}
+
+func TestSignDynamicFeeTransaction(t *testing.T) {
+	signer, err := NewKeySigner(mustHex(t, eip155Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, hash, err := signer.SignTransaction(&UnsignedTx{
+		Type:      TxTypeDynamicFee,
+		ChainID:   big.NewInt(1),
+		Nonce:     9,
+		GasTipCap: gwei(2),
+		GasFeeCap: gwei(20),
+		Gas:       21000,
+		To:        mustHex(t, "3535353535353535353535353535353535353535"),
+		Value:     etherWei(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0x" + hex.EncodeToString(keccak256(raw)); hash != want {
+		t.Errorf("hash = %s, want %s", hash, want)
+	}
+
+	// 0x02 || rlp([chainId, nonce, tip, feeCap, gas, to, value, data, accessList, v, r, s])
+	unsigned := "01" + "09" + "8477359400" + "8504a817c800" + "825208" +
+		"943535353535353535353535353535353535353535" + "880de0b6b3a7640000" + "80" + "c0"
+	encoded := hex.EncodeToString(raw)
+	if !strings.HasPrefix(encoded, "02f873"+unsigned) || len(raw) != 3+0x73 {
+		t.Fatalf("signed transaction %s does not encode the transaction fields %s", encoded, unsigned)
+	}
+
+	// The signature must recover to the signer over the EIP-1559 signing hash
+	signature := raw[len(raw)-67:]
+	if (signature[0] != 0x80 && signature[0] != 0x01) || signature[1] != 0xa0 || signature[34] != 0xa0 {
+		t.Fatalf("unexpected signature encoding %x", signature)
+	}
+	compact := []byte{27 + signature[0]&1}
+	compact = append(compact, signature[2:34]...)
+	compact = append(compact, signature[35:67]...)
+	sigHash := keccak256(mustHex(t, "02f0"+unsigned))
+	pub, _, err := ecdsa.RecoverCompact(compact, sigHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := publicKeyAddress(pub); got != signer.Address() {
+		t.Errorf("signature recovers to %s, want %s", got, signer.Address())
+	}
+}
+
+func TestSignTransactionRequiresChainID(t *testing.T) {
+	signer, err := NewKeySigner(mustHex(t, eip155Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := signer.SignTransaction(&UnsignedTx{Type: TxTypeLegacy, GasPrice: gwei(1), Gas: 21000}); err == nil {
+		t.Error("signed a transaction without a chain ID")
+	}
+}
+
+// The test vectors of the Web3 Secret Storage Definition, both for the key
+// 7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d
+var keystoreVectors = map[string]string{
+	"pbkdf2": `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+			"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+			"kdf": "pbkdf2",
+			"kdfparams": {
+				"c": 262144,
+				"dklen": 32,
+				"prf": "hmac-sha256",
+				"salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"
+			},
+			"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`,
+	"scrypt": `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "83dbcc02d8ccb40e466191a123791e0e"},
+			"ciphertext": "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+			"kdf": "scrypt",
+			"kdfparams": {
+				"dklen": 32,
+				"n": 262144,
+				"p": 8,
+				"r": 1,
+				"salt": "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"
+			},
+			"mac": "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`,
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	want, err := NewKeySigner(mustHex(t, "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for kdf, vector := range keystoreVectors {
+		t.Run(kdf, func(t *testing.T) {
+			path := filepath.Join(dir, kdf+".json")
+			if err := os.WriteFile(path, []byte(vector), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := NewKeystoreSigner(path, "testpassword")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signer.Address() != want.Address() {
+				t.Errorf("address = %s, want %s", signer.Address(), want.Address())
+			}
+			if _, err := NewKeystoreSigner(path, "wrongpassword"); err == nil || !strings.Contains(err.Error(), "wrong password") {
+				t.Errorf("wrong password: err = %v", err)
+			}
+		})
+	}
+
+	t.Run("address mismatch", func(t *testing.T) {
+		var file map[string]interface{}
+		if err := json.Unmarshal([]byte(keystoreVectors["pbkdf2"]), &file); err != nil {
+			t.Fatal(err)
+		}
+		file["address"] = "0000000000000000000000000000000000000001"
+		data, _ := json.Marshal(file)
+		path := filepath.Join(dir, "mismatch.json")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewKeystoreSigner(path, "testpassword"); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("err = %v, want an address mismatch", err)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewKeystoreSigner(path, "testpassword"); err == nil || !strings.Contains(err.Error(), "invalid keystore") {
+			t.Errorf("err = %v, want an invalid keystore error", err)
+		}
+	})
+}
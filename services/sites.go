@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Site routing modes
+const (
+	SiteRoutingPath = "path"
+	SiteRoutingHost = "host"
+)
+
+// SiteStore keeps built frontends on disk, one directory per deployment
+type SiteStore struct {
+	root      string
+	routing   string
+	publicURL string
+	domain    string
+}
+
+// NewSiteStore configures the site store using environment variables
+func NewSiteStore() *SiteStore {
+	root := os.Getenv("SITES_DIR")
+	if root == "" {
+		root = "./build/sites"
+	}
+
+	// Host routing needs the domain app-<id> hosts are under
+	domain := os.Getenv("DEPLOYMENT_DOMAIN")
+	routing := os.Getenv("SITE_ROUTING")
+	if routing != SiteRoutingHost || domain == "" {
+		routing = SiteRoutingPath
+	}
+
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		publicURL = "http://localhost:" + port
+	}
+
+	return &SiteStore{
+		root:      root,
+		routing:   routing,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		domain:    domain,
+	}
+}
+
+// Dir returns the directory holding the site of a deployment
+func (s *SiteStore) Dir(deploymentID int) string {
+	return filepath.Join(s.root, strconv.Itoa(deploymentID))
+}
+
+// BasePath returns the URL path prefix the site is served under
+func (s *SiteStore) BasePath(deploymentID int) string {
+	if s.routing == SiteRoutingHost {
+		return ""
+	}
+	return fmt.Sprintf("/apps/%d", deploymentID)
+}
+
+// assetTags are the script and stylesheet tags a page needs to render
+var assetTags = regexp.MustCompile(`(?i)<(?:script|link)\b[^>]*\s(?:src|href)=["']?(/[^"'\s>]*)`)
+
+// rootAssets returns the scripts and stylesheets an index.html loads from the
+// root of its host rather than from under basePath
+func rootAssets(index, basePath string) []string {
+	if basePath == "" {
+		return nil
+	}
+	var assets []string
+	for _, match := range assetTags.FindAllStringSubmatch(index, -1) {
+		ref := match[1]
+		// Protocol-relative URLs point at other hosts
+		if strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, basePath+"/") {
+			continue
+		}
+		if ext := path.Ext(strings.SplitN(ref, "?", 2)[0]); ext == ".js" || ext == ".mjs" || ext == ".css" {
+			assets = append(assets, ref)
+		}
+	}
+	return assets
+}
+
+// URL returns the public URL of a deployment's site
+func (s *SiteStore) URL(deploymentID int) string {
+	if s.routing == SiteRoutingHost {
+		return fmt.Sprintf("https://app-%d.%s/", deploymentID, s.domain)
+	}
+	return fmt.Sprintf("%s/apps/%d/", s.publicURL, deploymentID)
+}
+
+// DeploymentFromHost extracts the deployment ID from an app-<id>.<domain> host
+func (s *SiteStore) DeploymentFromHost(host string) (int, bool) {
+	if s.routing != SiteRoutingHost {
+		return 0, false
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+
+	label, ok := strings.CutSuffix(host, "."+s.domain)
+	if !ok {
+		return 0, false
+	}
+	idStr, ok := strings.CutPrefix(label, "app-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Open opens the file of the deployment's site a request path maps to. Unknown
+// paths fall back to index.html so client-side routing keeps working. Files
+// are opened within the site directory, so neither ../ nor symlinks in the
+// built repository reach files outside it.
+func (s *SiteStore) Open(deploymentID int, requestPath string) (*os.File, os.FileInfo, error) {
+	root, err := os.OpenRoot(s.Dir(deploymentID))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer root.Close()
+
+	name := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if name == "" {
+		name = "."
+	}
+	candidates := []string{name, path.Join(name, "index.html")}
+	if name != "." {
+		candidates = append(candidates, name+".html")
+	}
+	// Missing assets should 404 rather than return the app shell
+	if path.Ext(name) == "" {
+		candidates = append(candidates, "index.html")
+	}
+	for _, candidate := range candidates {
+		file, err := root.Open(candidate)
+		if err != nil {
+			continue
+		}
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			file.Close()
+			continue
+		}
+		return file, info, nil
+	}
+	return nil, nil, os.ErrNotExist
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRootAssets(t *testing.T) {
+	tests := []struct {
+		name     string
+		index    string
+		basePath string
+		want     []string
+	}{
+		{
+			name:     "vite built for the root",
+			index:    `<script type="module" crossorigin src="/assets/index-Bx1.js"></script><link rel="stylesheet" crossorigin href="/assets/index-C2.css">`,
+			basePath: "/apps/7",
+			want:     []string{"/assets/index-Bx1.js", "/assets/index-C2.css"},
+		},
+		{
+			name:     "vite built with --base",
+			index:    `<script type="module" crossorigin src="/apps/7/assets/index-Bx1.js"></script><link rel="stylesheet" crossorigin href="/apps/7/assets/index-C2.css">`,
+			basePath: "/apps/7",
+		},
+		{
+			name:     "next export without basePath",
+			index:    `<link rel="preload" href="/_next/static/media/font.woff2" as="font"/><link rel="stylesheet" href="/_next/static/css/app.css?v=1"/><script src="/_next/static/chunks/main.js" async=""></script>`,
+			basePath: "/apps/7",
+			want:     []string{"/_next/static/css/app.css?v=1", "/_next/static/chunks/main.js"},
+		},
+		{
+			name:     "relative, external and other host assets",
+			index:    `<script src="./main.js"></script><script src="https://cdn.example.com/lib.js"></script><link href="//fonts.example.com/font.css" rel="stylesheet"><link rel="icon" href="/favicon.ico"><a href="/about">About</a>`,
+			basePath: "/apps/7",
+		},
+		{
+			name:  "host routing",
+			index: `<script src="/assets/index.js"></script>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := rootAssets(test.index, test.basePath); !slices.Equal(got, test.want) {
+				t.Errorf("rootAssets() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunScriptCommand(t *testing.T) {
+	tests := []struct {
+		packageManager string
+		want           []string
+	}{
+		{PackageManagerNPM, []string{"npm", "run", "build", "--", "--base=/apps/7/"}},
+		{PackageManagerYarn, []string{"sh", "-c", "corepack enable && yarn run build '--base=/apps/7/'"}},
+		{PackageManagerPNPM, []string{"sh", "-c", "corepack enable && pnpm run build '--base=/apps/7/'"}},
+	}
+
+	for _, test := range tests {
+		layout := &ProjectLayout{PackageManager: test.packageManager}
+		if got := layout.RunScriptCommand("build", "--base=/apps/7/"); !slices.Equal(got, test.want) {
+			t.Errorf("%s: RunScriptCommand() = %q, want %q", test.packageManager, got, test.want)
+		}
+	}
+	if got := (&ProjectLayout{PackageManager: PackageManagerNPM}).RunScriptCommand("build"); !slices.Equal(got, []string{"npm", "run", "build"}) {
+		t.Errorf("RunScriptCommand() = %q without arguments", got)
+	}
+}
+
+func TestSiteStoreOpen(t *testing.T) {
+	root := t.TempDir()
+	store := &SiteStore{root: filepath.Join(root, "sites")}
+	site := store.Dir(7)
+
+	files := map[string]string{
+		"index.html":      "app",
+		"about.html":      "about",
+		"docs/index.html": "docs",
+		"assets/app.js":   "script",
+	}
+	for name, contents := range files {
+		path := filepath.Join(site, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A built repository may ship symlinks to files of the server
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"leak.txt":       filepath.Join(root, "secret.txt"),
+		"leak":           filepath.Join(root, "secret.txt"),
+		"outside":        root,
+		"assets/main.js": "app.js",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(site, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		// want is the contents served, empty for not found
+		want string
+	}{
+		{"/", "app"},
+		{"/assets/app.js", "script"},
+		{"/about", "about"},
+		{"/docs/", "docs"},
+		{"/dashboard/settings", "app"},
+		{"/missing.js", ""},
+		{"/../secret.txt", ""},
+		{"/leak.txt", ""},
+		{"/leak", "app"},
+		{"/outside/secret.txt", ""},
+		{"/assets/main.js", "script"},
+	}
+	for _, test := range tests {
+		file, _, err := store.Open(7, test.path)
+		if err != nil {
+			if test.want != "" {
+				t.Errorf("Open(%q): %v, want %q", test.path, err, test.want)
+			}
+			continue
+		}
+		contents, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != test.want {
+			t.Errorf("Open(%q) = %q, want %q", test.path, contents, test.want)
+		}
+	}
+
+	if _, _, err := store.Open(8, "/"); err == nil {
+		t.Error("opened the site of a deployment without one")
+	}
+}
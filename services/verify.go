@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"deploychain/models"
+)
+
+// Verifier submits the sources of deployed contracts to the Etherscan-compatible
+// API of their network and waits for the explorer to check them
+type Verifier struct {
+	client *http.Client
+	// pollInterval is how often explorers are asked whether they indexed a
+	// contract and for the outcome of its verification
+	pollInterval time.Duration
+	// timeout bounds the verification of a single contract, including waiting
+	// for the explorer to index its address
+	timeout time.Duration
+}
+
+// NewVerifier creates a verifier configured from the environment
+func NewVerifier() *Verifier {
+	return &Verifier{
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pollInterval: time.Duration(max(envInt("VERIFY_POLL_SECONDS", 5), 1)) * time.Second,
+		timeout:      time.Duration(envInt("VERIFY_TIMEOUT_SECONDS", 600)) * time.Second,
+	}
+}
+
+// Verification is the outcome of verifying a contract
+type Verification struct {
+	Status string
+	// GUID identifies the submission with the explorer
+	GUID    string
+	Message string
+}
+
+// explorerResponse is the envelope of Etherscan API responses
+type explorerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+// Verify submits the standard-JSON input of a deployed contract and polls the
+// explorer until it is verified or rejected. onSubmitted is called with the
+// GUID of the accepted submission.
+func (v *Verifier) Verify(ctx context.Context, network *models.Network, contract *models.CompiledContract, deployed models.ContractDeployment, onSubmitted func(guid string)) Verification {
+	if contract.SourceCode == "" {
+		return Verification{Status: models.VerificationSkipped, Message: "no standard-JSON input, only Hardhat builds keep one"}
+	}
+	if contract.CompilerVersion == "" {
+		return Verification{Status: models.VerificationSkipped, Message: "unknown compiler version"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	form := url.Values{
+		"module":          {"contract"},
+		"action":          {"verifysourcecode"},
+		"contractaddress": {deployed.Address},
+		"sourceCode":      {contract.SourceCode},
+		"codeformat":      {"solidity-standard-json-input"},
+		"contractname":    {contract.SourcePath + ":" + contract.Name},
+		"compilerversion": {"v" + strings.TrimPrefix(contract.CompilerVersion, "v")},
+		// The misspelling is the parameter name of the Etherscan API
+		"constructorArguements": {deployed.ConstructorArgs},
+	}
+
+	// Explorers reject submissions until they have indexed the contract
+	var guid, notIndexed string
+	for guid == "" {
+		resp, err := v.call(ctx, http.MethodPost, network, form)
+		switch {
+		case err != nil && notIndexed != "" && ctx.Err() != nil:
+			return v.failure(ctx, "explorer did not index %s: %s", deployed.Address, notIndexed)
+		case err != nil:
+			return v.failure(ctx, "submission failed: %v", err)
+		case alreadyVerified(resp.Result):
+			return Verification{Status: models.VerificationVerified, Message: resp.Result}
+		case resp.Status == "1":
+			guid = resp.Result
+		case !strings.Contains(strings.ToLower(resp.Result), "unable to locate contractcode"):
+			return Verification{Status: models.VerificationFailed, Message: resp.Result}
+		default:
+			notIndexed = resp.Result
+			if err := sleepContext(ctx, v.pollInterval); err != nil {
+				return v.failure(ctx, "explorer did not index %s: %s", deployed.Address, notIndexed)
+			}
+		}
+	}
+	onSubmitted(guid)
+
+	query := url.Values{
+		"module": {"contract"},
+		"action": {"checkverifystatus"},
+		"guid":   {guid},
+	}
+	for {
+		if err := sleepContext(ctx, v.pollInterval); err != nil {
+			result := v.failure(ctx, "no verification result: %v", err)
+			result.GUID = guid
+			return result
+		}
+		resp, err := v.call(ctx, http.MethodGet, network, query)
+		if err != nil {
+			// Explorers have transient failures, the timeout ends the polling
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("Failed to check verification %s on %s: %v", guid, network.Name, err)
+			continue
+		}
+		switch {
+		case strings.Contains(strings.ToLower(resp.Result), "pending"):
+			continue
+		case resp.Status == "1" || alreadyVerified(resp.Result):
+			return Verification{Status: models.VerificationVerified, GUID: guid, Message: resp.Result}
+		default:
+			return Verification{Status: models.VerificationFailed, GUID: guid, Message: resp.Result}
+		}
+	}
+}
+
+// failure is a failed verification, reporting the timeout or cancellation that ended it
+func (v *Verifier) failure(ctx context.Context, format string, args ...interface{}) Verification {
+	message := fmt.Sprintf(format, args...)
+	if ctx.Err() == context.DeadlineExceeded {
+		message = fmt.Sprintf("timed out after %s: %s", v.timeout, message)
+	}
+	return Verification{Status: models.VerificationFailed, Message: message}
+}
+
+// call sends a request to the verification API of a network. The chain ID and
+// API key are added to every request.
+func (v *Verifier) call(ctx context.Context, method string, network *models.Network, params url.Values) (*explorerResponse, error) {
+	endpoint, err := url.Parse(network.VerifyAPIURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification API URL: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("chainid", strconv.FormatInt(network.ChainID, 10))
+	if network.VerifyAPIKey != "" {
+		query.Set("apikey", network.VerifyAPIKey)
+	}
+
+	var body io.Reader
+	if method == http.MethodGet {
+		for name, values := range params {
+			query[name] = values
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var resp explorerResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return &resp, nil
+}
+
+// alreadyVerified reports whether an explorer result says the contract was verified before
+func alreadyVerified(result string) bool {
+	return strings.Contains(strings.ToLower(result), "already verified")
+}
+
+// sleepContext waits for d, returning early with the error of ctx when it is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// verifyDeployment checks the code of the contracts deployed to every network
+// against a local recompilation, and submits their sources to the explorer of
+// networks that have a verification API. It runs once the deployment is
+// recorded and does not change its outcome.
+func (d *Deployer) verifyDeployment(ctx context.Context, runs []*networkRun, plan []DeployTarget, logger *BuildLogger) {
+	var deployed []*networkRun
+	for _, run := range runs {
+		if run.err == nil && len(run.contracts) > 0 {
+			deployed = append(deployed, run)
+		}
+	}
+	if len(deployed) == 0 {
+		return
+	}
+
+	contracts := make(map[string]*models.CompiledContract, len(plan))
+	for _, target := range plan {
+		contracts[target.Name] = target.Contract
+	}
+
+	logger.StartStage(models.StageVerify)
+	d.matchBytecode(ctx, deployed, contracts, logger)
+	forEachRun(deployed, func(run *networkRun) {
+		if run.network.VerifyAPIURL != "" {
+			d.verifyNetwork(ctx, run, contracts, logger)
+		}
+	})
+	if ctx.Err() != nil {
+		logger.Warn(models.StageVerify, "Verification cancelled")
+		logger.EndStage(models.StageVerify, ctx.Err())
+		return
+	}
+	logger.EndStage(models.StageVerify, nil)
+}
+
+// verifyNetwork verifies the contracts of a run one at a time, explorers
+// rate limiting submissions
+func (d *Deployer) verifyNetwork(ctx context.Context, run *networkRun, contracts map[string]*models.CompiledContract, logger *BuildLogger) {
+	network := run.network
+	for _, deployed := range run.contracts {
+		if ctx.Err() != nil {
+			return
+		}
+		contract, ok := contracts[deployed.Name]
+		if !ok || deployed.Address == "" {
+			continue
+		}
+
+		record := func(status, guid, message string) {
+			if err := d.db.UpdateContractVerification(run.record.DeploymentID, network.Name, deployed.Name, status, guid, message); err != nil {
+				log.Printf("Failed to record verification of %s on %s: %v", deployed.Name, network.Name, err)
+			}
+		}
+		result := d.verifier.Verify(ctx, network, contract, deployed, func(guid string) {
+			logger.Info(models.StageVerify, "[%s] Submitted %s for verification (%s)", network.Name, deployed.Name, guid)
+			record(models.VerificationPending, guid, "")
+		})
+		record(result.Status, result.GUID, result.Message)
+
+		switch result.Status {
+		case models.VerificationVerified:
+			logger.Info(models.StageVerify, "[%s] Verified %s at %s", network.Name, deployed.Name, deployed.Address)
+		case models.VerificationSkipped:
+			logger.Info(models.StageVerify, "[%s] Not verifying %s: %s", network.Name, deployed.Name, result.Message)
+		default:
+			logger.Warn(models.StageVerify, "[%s] Verification of %s failed: %s", network.Name, deployed.Name, result.Message)
+		}
+	}
+}
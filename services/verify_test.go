@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"deploychain/models"
+)
+
+// fakeExplorer serves the Etherscan verification API, answering submissions
+// and status checks from scripted responses. The last response of each script
+// is repeated.
+type fakeExplorer struct {
+	t           *testing.T
+	submissions []explorerResponse
+	checks      []explorerResponse
+
+	mu        sync.Mutex
+	submitted int
+	checked   int
+}
+
+func (f *fakeExplorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		f.t.Errorf("invalid request: %v", err)
+	}
+	if got := r.URL.Query().Get("chainid"); got != "11155111" {
+		f.t.Errorf("chainid = %q", got)
+	}
+	if got := r.URL.Query().Get("apikey"); got != "test-key" {
+		f.t.Errorf("apikey = %q", got)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp explorerResponse
+	switch action := r.Form.Get("action"); {
+	case r.Method == http.MethodPost && action == "verifysourcecode":
+		want := map[string]string{
+			"contractaddress":       "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+			"codeformat":            "solidity-standard-json-input",
+			"contractname":          "contracts/Token.sol:Token",
+			"compilerversion":       "v0.8.24+commit.e11b9ed9",
+			"constructorArguements": "0000000000000000000000000000000000000000000000000000000000000001",
+			"sourceCode":            `{"language":"Solidity"}`,
+		}
+		for name, value := range want {
+			if got := r.PostForm.Get(name); got != value {
+				f.t.Errorf("%s = %q, want %q", name, got, value)
+			}
+		}
+		resp = f.submissions[min(f.submitted, len(f.submissions)-1)]
+		f.submitted++
+	case r.Method == http.MethodGet && action == "checkverifystatus":
+		if got := r.Form.Get("guid"); got != "guid-1" {
+			f.t.Errorf("guid = %q", got)
+		}
+		resp = f.checks[min(f.checked, len(f.checks)-1)]
+		f.checked++
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestVerify(t *testing.T) {
+	notIndexed := explorerResponse{Status: "0", Message: "NOTOK", Result: "Unable to locate ContractCode at 0x5FbDB2315678afecb367f032d93F642f64180aa3"}
+	submitted := explorerResponse{Status: "1", Message: "OK", Result: "guid-1"}
+	pending := explorerResponse{Status: "0", Message: "NOTOK", Result: "Pending in queue"}
+	passed := explorerResponse{Status: "1", Message: "OK", Result: "Pass - Verified"}
+	failed := explorerResponse{Status: "0", Message: "NOTOK", Result: "Fail - Unable to verify"}
+
+	tests := []struct {
+		name        string
+		submissions []explorerResponse
+		checks      []explorerResponse
+		timeout     time.Duration
+
+		status  string
+		guid    string
+		message string
+		// submitted and checked count the requests the explorer answered
+		submitted int
+		checked   int
+	}{
+		{
+			name:        "waits for the explorer to index the contract",
+			submissions: []explorerResponse{notIndexed, notIndexed, submitted},
+			checks:      []explorerResponse{passed},
+			status:      models.VerificationVerified, guid: "guid-1", message: "Pass - Verified",
+			submitted: 3, checked: 1,
+		},
+		{
+			name:        "polls a pending verification until it passes",
+			submissions: []explorerResponse{submitted},
+			checks:      []explorerResponse{pending, pending, passed},
+			status:      models.VerificationVerified, guid: "guid-1", message: "Pass - Verified",
+			submitted: 1, checked: 3,
+		},
+		{
+			name:        "polls a pending verification until it fails",
+			submissions: []explorerResponse{submitted},
+			checks:      []explorerResponse{pending, failed},
+			status:      models.VerificationFailed, guid: "guid-1", message: "Fail - Unable to verify",
+			submitted: 1, checked: 2,
+		},
+		{
+			name:        "contract already verified",
+			submissions: []explorerResponse{{Status: "0", Message: "NOTOK", Result: "Contract source code already verified"}},
+			status:      models.VerificationVerified, message: "Contract source code already verified",
+			submitted: 1,
+		},
+		{
+			name:        "verified by the time the status is checked",
+			submissions: []explorerResponse{submitted},
+			checks:      []explorerResponse{{Status: "0", Message: "NOTOK", Result: "Already Verified"}},
+			status:      models.VerificationVerified, guid: "guid-1", message: "Already Verified",
+			submitted: 1, checked: 1,
+		},
+		{
+			name:        "submission rejected",
+			submissions: []explorerResponse{{Status: "0", Message: "NOTOK", Result: "Invalid API Key"}},
+			status:      models.VerificationFailed, message: "Invalid API Key",
+			submitted: 1,
+		},
+		{
+			name:        "times out waiting for the explorer to index the contract",
+			submissions: []explorerResponse{notIndexed},
+			timeout:     50 * time.Millisecond,
+			status:      models.VerificationFailed, message: "timed out after 50ms: explorer did not index",
+			submitted: -1,
+		},
+		{
+			name:        "times out while the verification is pending",
+			submissions: []explorerResponse{submitted},
+			checks:      []explorerResponse{pending},
+			timeout:     50 * time.Millisecond,
+			status:      models.VerificationFailed, guid: "guid-1", message: "timed out after 50ms: no verification result",
+			submitted: 1, checked: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			explorer := &fakeExplorer{t: t, submissions: test.submissions, checks: test.checks}
+			server := httptest.NewServer(explorer)
+			defer server.Close()
+
+			timeout := test.timeout
+			if timeout == 0 {
+				timeout = 10 * time.Second
+			}
+			verifier := &Verifier{client: server.Client(), pollInterval: time.Millisecond, timeout: timeout}
+			network := &models.Network{Name: "sepolia", ChainID: 11155111, VerifyAPIURL: server.URL + "/api", VerifyAPIKey: "test-key"}
+			contract := &models.CompiledContract{
+				Name:            "Token",
+				SourcePath:      "contracts/Token.sol",
+				SourceCode:      `{"language":"Solidity"}`,
+				CompilerVersion: "0.8.24+commit.e11b9ed9",
+			}
+			deployed := models.ContractDeployment{
+				Name:            "Token",
+				Address:         "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+				ConstructorArgs: "0000000000000000000000000000000000000000000000000000000000000001",
+			}
+
+			var onSubmitted string
+			result := verifier.Verify(context.Background(), network, contract, deployed, func(guid string) {
+				onSubmitted = guid
+			})
+
+			if result.Status != test.status || result.GUID != test.guid || !strings.HasPrefix(result.Message, test.message) {
+				t.Errorf("Verify() = %+v, want status %s, GUID %q and message %q", result, test.status, test.guid, test.message)
+			}
+			if onSubmitted != test.guid {
+				t.Errorf("onSubmitted called with %q, want %q", onSubmitted, test.guid)
+			}
+			explorer.mu.Lock()
+			defer explorer.mu.Unlock()
+			// -1 is any number of requests, as many as fit in the timeout
+			if test.submitted >= 0 && explorer.submitted != test.submitted {
+				t.Errorf("submitted %d times, want %d", explorer.submitted, test.submitted)
+			}
+			if test.checked >= 0 && explorer.checked != test.checked {
+				t.Errorf("checked %d times, want %d", explorer.checked, test.checked)
+			}
+		})
+	}
+}
+
+func TestVerifySkipsContractsWithoutSources(t *testing.T) {
+	verifier := &Verifier{client: http.DefaultClient, pollInterval: time.Millisecond, timeout: time.Second}
+	network := &models.Network{Name: "sepolia", ChainID: 11155111, VerifyAPIURL: "http://127.0.0.1:0/api"}
+
+	for _, contract := range []*models.CompiledContract{
+		{Name: "Token", CompilerVersion: "0.8.24+commit.e11b9ed9"},
+		{Name: "Token", SourceCode: `{"language":"Solidity"}`},
+	} {
+		result := verifier.Verify(context.Background(), network, contract, models.ContractDeployment{Name: "Token"}, func(guid string) {
+			t.Errorf("submitted %s", guid)
+		})
+		if result.Status != models.VerificationSkipped {
+			t.Errorf("Verify() = %+v, want skipped", result)
+		}
+	}
+}
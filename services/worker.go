@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"deploychain/models"
+)
+
+// JobHandler executes a leased job
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// WorkerPool runs queued jobs with a bounded number of concurrent workers
+type WorkerPool struct {
+	db           *Database
+	handler      JobHandler
+	owner        string
+	concurrency  int
+	lease        time.Duration
+	pollInterval time.Duration
+
+	// running maps deployment IDs to the cancel functions of their jobs
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+}
+
+// NewWorkerPool configures a worker pool using environment variables
+func NewWorkerPool(db *Database, handler JobHandler) *WorkerPool {
+	concurrency := envInt("WORKER_CONCURRENCY", 2)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// Heartbeats run every third of the lease, shorter leases expire under load
+	leaseSeconds := envInt("JOB_LEASE_SECONDS", 60)
+	if leaseSeconds < 10 {
+		leaseSeconds = 10
+	}
+
+	owner := os.Getenv("WORKER_ID")
+	if owner == "" {
+		hostname, _ := os.Hostname()
+		owner = fmt.Sprintf("%s-%d-%04x", hostname, os.Getpid(), rand.Intn(0x10000))
+	}
+
+	return &WorkerPool{
+		db:           db,
+		handler:      handler,
+		owner:        owner,
+		concurrency:  concurrency,
+		lease:        time.Duration(leaseSeconds) * time.Second,
+		pollInterval: 2 * time.Second,
+		running:      make(map[int]context.CancelFunc),
+	}
+}
+
+// Start recovers orphaned jobs and launches the workers until ctx is done
+func (p *WorkerPool) Start(ctx context.Context) {
+	p.recover()
+
+	for i := 0; i < p.concurrency; i++ {
+		go p.work(ctx)
+	}
+
+	// Jobs of crashed replicas become claimable once their lease expires
+	go func() {
+		ticker := time.NewTicker(p.lease)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.recover()
+			}
+		}
+	}()
+
+	log.Printf("Worker pool %s started with %d workers", p.owner, p.concurrency)
+}
+
+// recover requeues jobs whose lease expired
+func (p *WorkerPool) recover() {
+	requeued, failed, err := p.db.RecoverOrphanedJobs()
+	if err != nil {
+		log.Printf("Failed to recover orphaned jobs: %v", err)
+		return
+	}
+	if requeued > 0 || failed > 0 {
+		log.Printf("Recovered orphaned jobs: %d requeued, %d failed", requeued, failed)
+	}
+}
+
+// work claims and runs jobs one at a time
+func (p *WorkerPool) work(ctx context.Context) {
+	for {
+		job, err := p.db.ClaimJob(p.owner, p.lease)
+		if err != nil {
+			log.Printf("Failed to claim job: %v", err)
+		}
+		if job != nil {
+			p.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// Cancel stops the job of a deployment if it runs in this process. Jobs on
+// other replicas notice the cancellation on their next heartbeat.
+func (p *WorkerPool) Cancel(deploymentID int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cancel, ok := p.running[deploymentID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// run executes a job while heartbeating its lease
+func (p *WorkerPool) run(ctx context.Context, job *models.Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	p.running[job.DeploymentID] = cancel
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, job.DeploymentID)
+		p.mu.Unlock()
+	}()
+
+	var cancelRequested atomic.Bool
+	go func() {
+		ticker := time.NewTicker(p.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				requested, err := p.db.HeartbeatJob(job.ID, p.owner, p.lease)
+				if err != nil {
+					log.Printf("Heartbeat failed for job %d: %v", job.ID, err)
+					if err == ErrLeaseLost {
+						// Another worker owns the job now, stop working on it
+						cancel()
+						return
+					}
+					continue
+				}
+				if requested {
+					log.Printf("Cancellation requested for job %d", job.ID)
+					cancelRequested.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	log.Printf("Running job %d (%s) for deployment %d, attempt %d/%d",
+		job.ID, job.Kind, job.DeploymentID, job.Attempts, job.MaxAttempts)
+
+	jobErr := p.handler(jobCtx, job)
+
+	status, lastError := models.JobStatusCompleted, ""
+	switch {
+	case jobErr == nil:
+	case errors.Is(jobErr, ErrDeploymentCancelled), cancelRequested.Load():
+		status, lastError = models.JobStatusCancelled, jobErr.Error()
+		log.Printf("Job %d cancelled", job.ID)
+	default:
+		status, lastError = models.JobStatusFailed, jobErr.Error()
+		log.Printf("Job %d failed: %v", job.ID, jobErr)
+	}
+	if err := p.db.FinishJob(job.ID, p.owner, status, lastError); err != nil {
+		log.Printf("Failed to finish job %d: %v", job.ID, err)
+	}
+}
+
+// envInt reads an integer environment variable, falling back to def
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"deploychain/models"
+
+	"dagger.io/dagger"
+	"gopkg.in/yaml.v3"
+)
+
+// Package manager constants
+const (
+	PackageManagerNPM  = "npm"
+	PackageManagerYarn = "yarn"
+	PackageManagerPNPM = "pnpm"
+)
+
+// conventionalFrontendDirs are checked when a repository has no workspaces
+var conventionalFrontendDirs = []string{"frontend", "app", "web", "client"}
+
+// ProjectLayout describes where the contracts and frontend live in a repository.
+// Paths are relative to the repository root, "." meaning the root itself.
+type ProjectLayout struct {
+	Framework      string
+	PackageManager string
+	ContractsPath  string
+	FrontendPath   string
+	// Workspaces is true when dependencies are installed once from the root
+	Workspaces bool
+	// Packages are the workspace packages
+	Packages []string
+	// Repository is the URL the repository was cloned from, keying build caches
+	Repository string
+
+	// Overrides from deploychain.yaml, zero values keep the defaults
+	Env            map[string]string
+	Contracts      models.BuildSettings
+	Frontend       models.BuildSettings
+	FrontendOutput string
+}
+
+// packageJSON holds the package.json fields needed for layout detection
+type packageJSON struct {
+	Workspaces      json.RawMessage   `json:"workspaces"`
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// InstallDir returns the directory dependencies are installed from for a package
+func (l *ProjectLayout) InstallDir(pkgPath string) string {
+	if l.Workspaces {
+		return "."
+	}
+	return pkgPath
+}
+
+// InstallCommand returns the shell command installing dependencies
+func (l *ProjectLayout) InstallCommand() []string {
+	switch l.PackageManager {
+	case PackageManagerYarn:
+		return []string{"sh", "-c", "corepack enable && yarn install"}
+	case PackageManagerPNPM:
+		return []string{"sh", "-c", "corepack enable && pnpm install"}
+	default:
+		return []string{"npm", "install"}
+	}
+}
+
+// RunScriptCommand returns the shell command running a package.json script,
+// args being appended to the script's command
+func (l *ProjectLayout) RunScriptCommand(script string, args ...string) []string {
+	quoted := ""
+	for _, arg := range args {
+		quoted += " " + shellQuote(arg)
+	}
+	switch l.PackageManager {
+	case PackageManagerYarn:
+		return []string{"sh", "-c", "corepack enable && yarn run " + script + quoted}
+	case PackageManagerPNPM:
+		return []string{"sh", "-c", "corepack enable && pnpm run " + script + quoted}
+	default:
+		if len(args) > 0 {
+			args = append([]string{"--"}, args...)
+		}
+		return append([]string{"npm", "run", script}, args...)
+	}
+}
+
+// buildContainer starts a build container from the step's image, falling back to
+// defaultImage, with the manifest environment applied
+func (l *ProjectLayout) buildContainer(client *dagger.Client, defaultImage string, settings models.BuildSettings) *dagger.Container {
+	image := settings.Image
+	if image == "" {
+		image = defaultImage
+	}
+	container := client.Container().From(image)
+
+	env := make(map[string]string)
+	for name, value := range l.Env {
+		env[name] = value
+	}
+	for name, value := range settings.Env {
+		env[name] = value
+	}
+	// Sorted so identical settings produce identical, cacheable containers
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		container = container.WithEnvVariable(name, env[name])
+	}
+	return container
+}
+
+// installCommandFor returns the step's install command or the package manager default
+func (l *ProjectLayout) installCommandFor(settings models.BuildSettings) []string {
+	if settings.Install != "" {
+		return []string{"sh", "-c", settings.Install}
+	}
+	return l.InstallCommand()
+}
+
+// buildCommandFor returns the step's build command or defaultCommand
+func buildCommandFor(settings models.BuildSettings, defaultCommand []string) []string {
+	if settings.Build != "" {
+		return []string{"sh", "-c", settings.Build}
+	}
+	return defaultCommand
+}
+
+// detectLayout discovers workspace packages and picks the contract and frontend packages
+func (ds *DaggerService) detectLayout(ctx context.Context, repo *dagger.Directory) (*ProjectLayout, error) {
+	entries, err := repo.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &ProjectLayout{PackageManager: PackageManagerNPM}
+	rootFiles := make(map[string]bool)
+	for _, entry := range entries {
+		rootFiles[strings.TrimSuffix(entry, "/")] = true
+	}
+	if rootFiles["pnpm-lock.yaml"] {
+		layout.PackageManager = PackageManagerPNPM
+	} else if rootFiles["yarn.lock"] {
+		layout.PackageManager = PackageManagerYarn
+	}
+
+	patterns, err := ds.workspacePatterns(ctx, repo, rootFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	if len(patterns) > 0 {
+		layout.Workspaces = true
+		packages, err = ds.expandWorkspacePatterns(ctx, repo, patterns)
+		if err != nil {
+			return nil, err
+		}
+		layout.Packages = packages
+	} else {
+		for _, dir := range conventionalFrontendDirs {
+			if rootFiles[dir] {
+				packages = append(packages, dir)
+			}
+		}
+	}
+
+	// The root is a candidate too, single-package repositories keep everything there
+	candidates := append([]string{"."}, packages...)
+
+	for _, candidate := range candidates {
+		framework, err := ds.detectWeb3Project(ctx, subdirectory(repo, candidate))
+		if err != nil {
+			// Workspace globs may match paths that do not exist
+			continue
+		}
+		if framework != "" {
+			layout.Framework = framework
+			layout.ContractsPath = candidate
+			break
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate == layout.ContractsPath && candidate != "." {
+			continue
+		}
+		isFrontend, err := ds.isFrontendPackage(ctx, subdirectory(repo, candidate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %v", candidate, err)
+		}
+		if isFrontend {
+			layout.FrontendPath = candidate
+			break
+		}
+	}
+
+	return layout, nil
+}
+
+// workspacePatterns reads the yarn/npm workspaces from package.json or the pnpm workspace file
+func (ds *DaggerService) workspacePatterns(ctx context.Context, repo *dagger.Directory, rootFiles map[string]bool) ([]string, error) {
+	if rootFiles["pnpm-workspace.yaml"] {
+		contents, err := repo.File("pnpm-workspace.yaml").Contents(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var workspace struct {
+			Packages []string `yaml:"packages"`
+		}
+		if err := yaml.Unmarshal([]byte(contents), &workspace); err != nil {
+			return nil, fmt.Errorf("invalid pnpm-workspace.yaml: %v", err)
+		}
+		return workspace.Packages, nil
+	}
+
+	if !rootFiles["package.json"] {
+		return nil, nil
+	}
+	pkg, err := readPackageJSON(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkg.Workspaces) == 0 {
+		return nil, nil
+	}
+
+	// Workspaces is either a list of globs or, for yarn, an object with a packages list
+	var patterns []string
+	if err := json.Unmarshal(pkg.Workspaces, &patterns); err == nil {
+		return patterns, nil
+	}
+	var workspaces struct {
+		Packages []string `json:"packages"`
+	}
+	if err := json.Unmarshal(pkg.Workspaces, &workspaces); err != nil {
+		return nil, fmt.Errorf("invalid workspaces in package.json: %v", err)
+	}
+	return workspaces.Packages, nil
+}
+
+// expandWorkspacePatterns resolves workspace globs such as packages/* to package directories
+func (ds *DaggerService) expandWorkspacePatterns(ctx context.Context, repo *dagger.Directory, patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var packages []string
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+		if pattern == "" || strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		matches := []string{"."}
+		for _, segment := range strings.Split(pattern, "/") {
+			var next []string
+			for _, dir := range matches {
+				if !strings.ContainsAny(segment, "*?[") {
+					next = append(next, path.Join(dir, segment))
+					continue
+				}
+				entries, err := subdirectory(repo, dir).Entries(ctx)
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					if !strings.HasSuffix(entry, "/") {
+						continue
+					}
+					name := strings.TrimSuffix(entry, "/")
+					if ok, _ := path.Match(segment, name); ok {
+						next = append(next, path.Join(dir, name))
+					}
+				}
+			}
+			matches = next
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				packages = append(packages, match)
+			}
+		}
+	}
+
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// isFrontendPackage checks for a Next.js, Vite or other buildable web app
+func (ds *DaggerService) isFrontendPackage(ctx context.Context, dir *dagger.Directory) (bool, error) {
+	entries, err := dir.Entries(ctx)
+	if err != nil {
+		// Workspace globs may match paths that do not exist
+		return false, nil
+	}
+
+	hasPackageJSON := false
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry, "/")
+		if strings.HasPrefix(name, "next.config.") || strings.HasPrefix(name, "vite.config.") {
+			return true, nil
+		}
+		if name == "package.json" {
+			hasPackageJSON = true
+		}
+	}
+	if !hasPackageJSON {
+		return false, nil
+	}
+
+	pkg, err := readPackageJSON(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := pkg.Scripts["build"]; !ok {
+		return false, nil
+	}
+	for _, dep := range []string{"next", "vite", "react-scripts", "react", "vue", "svelte"} {
+		if _, ok := pkg.Dependencies[dep]; ok {
+			return true, nil
+		}
+		if _, ok := pkg.DevDependencies[dep]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readPackageJSON parses the package.json at the root of dir
+func readPackageJSON(ctx context.Context, dir *dagger.Directory) (*packageJSON, error) {
+	contents, err := dir.File("package.json").Contents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal([]byte(contents), &pkg); err != nil {
+		return nil, fmt.Errorf("invalid package.json: %v", err)
+	}
+	return &pkg, nil
+}
+
+// subdirectory returns dir itself for "." and the named subdirectory otherwise
+func subdirectory(dir *dagger.Directory, p string) *dagger.Directory {
+	if p == "" || p == "." {
+		return dir
+	}
+	return dir.Directory(p)
+}
+
+// containerPath joins a repository-relative path onto a container mount point
+func containerPath(mount, p string) string {
+	return path.Join(mount, p)
+}
+
+// recordLayout copies the detected layout onto the build result
+func recordLayout(result *models.BuildResult, layout *ProjectLayout) {
+	result.Framework = layout.Framework
+	result.PackageManager = layout.PackageManager
+	result.ContractsPath = layout.ContractsPath
+	result.FrontendPath = layout.FrontendPath
+}